@@ -37,7 +37,7 @@ type Cache interface {
 }
 
 // Config holds configuration parameters for cache implementations.
-// This struct can be extended with additional fields as needed (e.g., max size, eviction policy).
+// The bounds, eviction policy and callbacks apply to LocalCache.
 type Config struct {
 	// DefaultTTL is the default time-to-live for cache entries when no specific TTL is provided.
 	// After this duration, entries are considered expired and will be evicted.
@@ -45,6 +45,23 @@ type Config struct {
 
 	// CleanupDurationInterval defines how often the cache should perform cleanup of expired entries.
 	CleanupDurationInterval time.Duration
+
+	// MaxEntries bounds the number of entries; 0 means unbounded.
+	MaxEntries int
+
+	// MaxBytes bounds the estimated size of the entries, as returned by SizeFunc; 0 means unbounded.
+	// An entry larger than the budget is evicted right after being added.
+	MaxBytes int64
+
+	// EvictionPolicy selects the entries evicted once a bound is reached, EvictionLRU by default.
+	EvictionPolicy EvictionPolicy
+
+	// SizeFunc estimates the size of an entry in bytes, EstimateSize by default.
+	SizeFunc func(key string, value any) int64
+
+	// OnEvict is called for entries evicted to stay within the bounds or removed after their TTL,
+	// but not for explicit deletes. It runs outside the cache lock, so it may use the cache.
+	OnEvict func(key string, value any, reason EvictionReason)
 }
 
 // NewDefaultConfig creates a CacheConfig with sensible defaults.
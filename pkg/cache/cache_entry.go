@@ -1,6 +1,9 @@
 package cache
 
-import "time"
+import (
+	"container/list"
+	"time"
+)
 
 // cacheEntry represents a single cached item with its expiration time.
 // This internal structure tracks both the cached value and when it should expire.
@@ -9,6 +12,14 @@ type cacheEntry struct {
 	value   any       // The actual cached value
 	evictAt time.Time // When this entry expires and should be evicted
 	index   int
+	size    int64 // Estimated size in bytes, when the cache has a byte budget or a SizeFunc
+
+	// Eviction policy state of bounded caches
+	element   *list.Element // Position in the LRU or W-TinyLFU segment list
+	segment   int           // W-TinyLFU segment holding the entry
+	frequency uint64        // LFU use count
+	lastUsed  uint64        // LFU logical time of the last use
+	lfuIndex  int           // Position in the LFU heap
 }
 
 // cacheItemsHeap implements a min-heap sorted by evictionTime.
@@ -34,7 +34,6 @@ type CachedBackend struct {
 	defaultTTL       time.Duration    // Default TTL for cached entries
 	methodSignatures sync.Map         // Cache of method signatures to avoid reflection overhead
 	methodConfigs    sync.Map         // Per-method configuration (TTL, cache behavior)
-	keyRegistry      sync.Map         // Maps method:prefixArgs to list of full cache keys
 }
 
 // NewCachedBackend creates a new caching wrapper for any backend.
@@ -71,20 +70,23 @@ func NewCachedBackend(backend CacheableBackend, cache Cache, defaultTTL time.Dur
 
 // BuildCacheKey generates a deterministic cache key from method name and arguments.
 // It uses JSON serialization and SHA256 hashing to ensure consistent keys
-// even for complex argument types.
+// even for complex argument types. Keys of calls with arguments start with the
+// hash of the first argument, so InvalidateMethodPrefix can delete them by prefix
+// on every node sharing the cache.
 //
 // Parameters:
 //   - method: The method name being cached
 //   - args: Variable arguments that were passed to the method
 //
 // Returns:
-//   - string: A cache key in format "methodName:hashPrefix"
+//   - string: A cache key in format "methodName:firstArgHash:hashPrefix", or
+//     "methodName:hashPrefix" without arguments
 //   - error: If marshaling arguments fails
 //
 // Example:
 //
 //	key, _ := BuildCacheKey("FindUserByID", "user-123")
-//	// Returns: "FindUserByID:a3b4c5d6"
+//	// Returns: "FindUserByID:1f2e3d4c5b6a7980:a3b4c5d6e7f80912"
 func (cb *CachedBackend) BuildCacheKey(method string, args ...interface{}) (string, error) {
 	keyData := struct {
 		Method string        `json:"method"`
@@ -100,22 +102,29 @@ func (cb *CachedBackend) BuildCacheKey(method string, args ...interface{}) (stri
 		return "", fmt.Errorf("failed to marshal cache key: %w", err)
 	}
 
-	// Use SHA256 hash to create a fixed-length key prefix
+	// Use SHA256 hash to create a fixed-length key suffix
 	hash := sha256.Sum256(jsonBytes)
-	cacheKey := fmt.Sprintf("%s:%x", method, hash[:8])
-
-	// Register this key with its method and first argument (if any) for prefix invalidation
-	if len(args) > 0 {
-		// Create a registry key from method and first argument
-		registryKey := fmt.Sprintf("%s:%v", method, args[0])
+	if len(args) == 0 {
+		return fmt.Sprintf("%s:%x", method, hash[:8]), nil
+	}
 
-		// Get or create the list of cache keys for this prefix
-		val, _ := cb.keyRegistry.LoadOrStore(registryKey, &sync.Map{})
-		keySet := val.(*sync.Map)
-		keySet.Store(cacheKey, true)
+	// Prefix it with the method and first argument (if any) for prefix invalidation
+	prefix, err := methodPrefix(method, args[0])
+	if err != nil {
+		return "", err
 	}
+	return fmt.Sprintf("%s%x", prefix, hash[:8]), nil
+}
 
-	return cacheKey, nil
+// methodPrefix returns the key prefix shared by the cache keys of method calls whose first
+// argument is firstArg.
+func methodPrefix(method string, firstArg interface{}) (string, error) {
+	jsonBytes, err := json.Marshal(firstArg)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cache key: %w", err)
+	}
+	hash := sha256.Sum256(jsonBytes)
+	return fmt.Sprintf("%s:%x:", method, hash[:8]), nil
 }
 
 // GetCached implements the cache-aside pattern for any function.
@@ -237,7 +246,9 @@ func (cb *CachedBackend) InvalidateMethod(ctx context.Context, method string, ar
 
 // InvalidateMethodPrefix invalidates all cache entries for a method that start with given arguments.
 // This is useful when you want to invalidate all variations of a method call that share
-// the same prefix arguments but may have different trailing arguments.
+// the same prefix arguments but may have different trailing arguments. Entries are matched by
+// method and first argument, and deleted by key prefix, so the cache must support DeleteByPrefix;
+// with a TieredCache, the entries are deleted from the shared tier and the L1 of every node.
 //
 // Parameters:
 //   - ctx: Context for cache operations
@@ -245,7 +256,7 @@ func (cb *CachedBackend) InvalidateMethod(ctx context.Context, method string, ar
 //   - prefixArgs: The prefix arguments that identify the entries to invalidate
 //
 // Returns:
-//   - error: Any error from cache operations
+//   - error: Any error from cache operations, or an error if the cache lacks DeleteByPrefix
 //
 // Example:
 //
@@ -255,35 +266,22 @@ func (cb *CachedBackend) InvalidateMethod(ctx context.Context, method string, ar
 //	// FindStateFull("state-123", flags2)
 //	// etc.
 func (cb *CachedBackend) InvalidateMethodPrefix(ctx context.Context, method string, prefixArgs ...interface{}) error {
-	// Build the registry key to find all cache keys for this method+prefix combination
-	if len(prefixArgs) == 0 {
-		// No prefix args, just delete all entries for this method
-		prefix := fmt.Sprintf("%s:", method)
-		if deleter, ok := cb.cache.(interface {
-			DeleteByPrefix(context.Context, string) error
-		}); ok {
-			return deleter.DeleteByPrefix(ctx, prefix)
+	// No prefix args, just delete all entries for this method
+	prefix := fmt.Sprintf("%s:", method)
+	if len(prefixArgs) > 0 {
+		// Only the entries of this method and first argument
+		var err error
+		if prefix, err = methodPrefix(method, prefixArgs[0]); err != nil {
+			return err
 		}
-		return nil
 	}
 
-	// Look up registered keys for this method and first argument
-	registryKey := fmt.Sprintf("%s:%v", method, prefixArgs[0])
-	if val, ok := cb.keyRegistry.Load(registryKey); ok {
-		keySet := val.(*sync.Map)
-
-		// Delete each registered cache key
-		keySet.Range(func(key, _ interface{}) bool {
-			cacheKey := key.(string)
-			cb.cache.Delete(ctx, cacheKey)
-			return true
-		})
-
-		// Clear the registry for this prefix
-		cb.keyRegistry.Delete(registryKey)
+	if deleter, ok := cb.cache.(interface {
+		DeleteByPrefix(context.Context, string) error
+	}); ok {
+		return deleter.DeleteByPrefix(ctx, prefix)
 	}
-
-	return nil
+	return fmt.Errorf("cache %T does not support DeleteByPrefix, cannot invalidate %s", cb.cache, prefix)
 }
 
 // GetBackend returns the underlying backend instance.
@@ -330,6 +328,9 @@ func CallCached[T any](cb *CachedBackend, ctx context.Context, method string, ar
 		return fetchFunc()
 	}
 
+	// Decode results cached by other processes as T
+	registerResultType[T](cb.cache)
+
 	// Try to get from cache
 	cached, err := cb.GetCached(ctx, cacheKey, func() (interface{}, error) {
 		return fetchFunc()
@@ -384,6 +385,9 @@ func CallCachedWithTTL[T any](cb *CachedBackend, ctx context.Context, method str
 		return fetchFunc()
 	}
 
+	// Decode results cached by other processes as T
+	registerResultType[T](cb.cache)
+
 	// Try to get from cache with custom TTL
 	cached, err := cb.GetCachedWithTTL(ctx, cacheKey, ttl, func() (interface{}, error) {
 		return fetchFunc()
@@ -403,6 +407,18 @@ func CallCachedWithTTL[T any](cb *CachedBackend, ctx context.Context, method str
 	return result, nil
 }
 
+// registerResultType registers T with caches that restore values by their registered type, such
+// as a RedisCache using JSONSerializer, so results another process cached pass the type assertion
+// of CallCached instead of being decoded as generic JSON.
+func registerResultType[T any](c Cache) {
+	registry, ok := c.(typeRegistry)
+	if !ok || reflect.TypeFor[T]().Kind() == reflect.Interface {
+		return // interface results are stored by their dynamic type, which T does not tell
+	}
+	var sample T
+	registry.RegisterType(sample)
+}
+
 // CacheOptions provides configuration for cache operations.
 // This can be extended with additional options as needed.
 type CacheOptions struct {
@@ -0,0 +1,372 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+)
+
+// EvictionPolicy selects which entries a bounded LocalCache evicts to stay within its
+// MaxEntries and MaxBytes limits.
+type EvictionPolicy string
+
+const (
+	// EvictionLRU evicts the least recently used entry. It is the default policy.
+	EvictionLRU EvictionPolicy = "lru"
+
+	// EvictionLFU evicts the least frequently used entry, the least recently used among equals.
+	EvictionLFU EvictionPolicy = "lfu"
+
+	// EvictionTinyLFU is W-TinyLFU: new entries go through a small LRU window, then are only
+	// admitted to the main segmented LRU if they are used more often than the entry they would
+	// replace, as estimated by a frequency sketch. It resists scans and one-off bursts of keys.
+	EvictionTinyLFU EvictionPolicy = "w-tinylfu"
+)
+
+// EvictionReason tells why an entry was evicted.
+type EvictionReason string
+
+const (
+	EvictionCapacity EvictionReason = "capacity" // evicted to stay within MaxEntries or MaxBytes
+	EvictionExpired  EvictionReason = "expired"  // removed by the cleanup after its TTL
+)
+
+// evictionPolicy orders the entries of a bounded LocalCache. Its methods are called with the
+// cache write lock held.
+type evictionPolicy interface {
+	add(entry *cacheEntry)               // entry was added to the cache
+	access(entry *cacheEntry)            // entry was read or updated
+	miss(key string)                     // key was looked up but not found
+	remove(entry *cacheEntry)            // entry was removed from the cache
+	victim(keep *cacheEntry) *cacheEntry // next entry to evict other than keep, nil if none
+	reset()                              // all entries were removed
+}
+
+// newEvictionPolicy returns the policy of config, or nil if the cache is unbounded. full tells
+// if the cache has reached its bounds.
+func newEvictionPolicy(config *Config, full func() bool) evictionPolicy {
+	if config.MaxEntries <= 0 && config.MaxBytes <= 0 {
+		return nil
+	}
+
+	switch config.EvictionPolicy {
+	case EvictionLRU, "":
+		return &lruPolicy{order: list.New()}
+	case EvictionLFU:
+		return &lfuPolicy{}
+	case EvictionTinyLFU:
+		return newTinyLFUPolicy(config.MaxEntries, full)
+	default:
+		log.Printf("unknown cache eviction policy %s, using %s", config.EvictionPolicy, EvictionLRU)
+		return &lruPolicy{order: list.New()}
+	}
+}
+
+// lruPolicy keeps entries from the most to the least recently used.
+type lruPolicy struct {
+	order *list.List
+}
+
+func (p *lruPolicy) add(entry *cacheEntry)    { entry.element = p.order.PushFront(entry) }
+func (p *lruPolicy) access(entry *cacheEntry) { p.order.MoveToFront(entry.element) }
+func (p *lruPolicy) miss(string)              {}
+func (p *lruPolicy) remove(entry *cacheEntry) { p.order.Remove(entry.element) }
+func (p *lruPolicy) reset()                   { p.order.Init() }
+
+func (p *lruPolicy) victim(keep *cacheEntry) *cacheEntry {
+	for element := p.order.Back(); element != nil; element = element.Prev() {
+		if entry := element.Value.(*cacheEntry); entry != keep {
+			return entry
+		}
+	}
+	return nil
+}
+
+// lfuPolicy keeps entries in a min-heap of their use count, breaking ties by last use.
+type lfuPolicy struct {
+	entries lfuHeap
+	clock   uint64 // logical time of the last use
+}
+
+func (p *lfuPolicy) add(entry *cacheEntry) {
+	p.clock++
+	entry.frequency, entry.lastUsed = 1, p.clock
+	heap.Push(&p.entries, entry)
+}
+
+func (p *lfuPolicy) access(entry *cacheEntry) {
+	p.clock++
+	entry.frequency++
+	entry.lastUsed = p.clock
+	heap.Fix(&p.entries, entry.lfuIndex)
+}
+
+func (p *lfuPolicy) miss(string)              {}
+func (p *lfuPolicy) remove(entry *cacheEntry) { heap.Remove(&p.entries, entry.lfuIndex) }
+func (p *lfuPolicy) reset()                   { p.entries = nil }
+
+func (p *lfuPolicy) victim(keep *cacheEntry) *cacheEntry {
+	if len(p.entries) == 0 {
+		return nil
+	}
+	if p.entries[0] != keep {
+		return p.entries[0]
+	}
+
+	// keep is the root, the next least used entry is one of its children
+	var victim *cacheEntry
+	for i := 1; i <= 2 && i < len(p.entries); i++ {
+		if victim == nil || p.entries.Less(i, victim.lfuIndex) {
+			victim = p.entries[i]
+		}
+	}
+	return victim
+}
+
+// lfuHeap implements a min-heap sorted by use count, then last use.
+type lfuHeap []*cacheEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].frequency != h[j].frequency {
+		return h[i].frequency < h[j].frequency
+	}
+	return h[i].lastUsed < h[j].lastUsed
+}
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].lfuIndex = i
+	h[j].lfuIndex = j
+}
+func (h *lfuHeap) Push(x any) {
+	entry := x.(*cacheEntry)
+	entry.lfuIndex = len(*h)
+	*h = append(*h, entry)
+}
+func (h *lfuHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	entry.lfuIndex = -1
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// Segments of the W-TinyLFU policy.
+const (
+	segmentWindow    = iota // recently added entries, not yet admitted
+	segmentProbation        // admitted entries used once since
+	segmentProtected        // admitted entries used again
+)
+
+// tinyLFUPolicy implements W-TinyLFU: a window LRU holding about 1% of the entries in front of a
+// segmented LRU, whose protected segment holds about 80% of the main entries. Until the cache is
+// full, entries overflowing the window move to the main segments. Then the oldest window entry
+// only replaces the main victim if the sketch estimates it is used more often.
+type tinyLFUPolicy struct {
+	maxEntries int         // 0 when only bounded by bytes, segments are then sized on the current entries
+	full       func() bool // tells if the cache has reached its bounds
+	segments   [3]*list.List
+	sketch     *frequencySketch
+}
+
+func newTinyLFUPolicy(maxEntries int, full func() bool) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		maxEntries: maxEntries,
+		full:       full,
+		segments:   [3]*list.List{list.New(), list.New(), list.New()},
+		sketch:     newFrequencySketch(maxEntries),
+	}
+}
+
+func (p *tinyLFUPolicy) len() int {
+	return p.segments[segmentWindow].Len() + p.segments[segmentProbation].Len() + p.segments[segmentProtected].Len()
+}
+
+func (p *tinyLFUPolicy) windowCapacity() int {
+	total := p.maxEntries
+	if total <= 0 {
+		total = p.len()
+	}
+	return max(1, total/100)
+}
+
+func (p *tinyLFUPolicy) protectedCapacity() int {
+	main := p.maxEntries - p.windowCapacity()
+	if p.maxEntries <= 0 {
+		main = p.segments[segmentProbation].Len() + p.segments[segmentProtected].Len()
+	}
+	return max(1, main*8/10)
+}
+
+// move pushes entry to the front of segment.
+func (p *tinyLFUPolicy) move(entry *cacheEntry, segment int) {
+	p.segments[entry.segment].Remove(entry.element)
+	entry.segment = segment
+	entry.element = p.segments[segment].PushFront(entry)
+}
+
+func (p *tinyLFUPolicy) add(entry *cacheEntry) {
+	p.sketch.increment(entry.key)
+	entry.segment = segmentWindow
+	entry.element = p.segments[segmentWindow].PushFront(entry)
+
+	window := p.segments[segmentWindow]
+	for window.Len() > p.windowCapacity() && !p.full() {
+		p.move(window.Back().Value.(*cacheEntry), segmentProbation)
+	}
+}
+
+func (p *tinyLFUPolicy) access(entry *cacheEntry) {
+	p.sketch.increment(entry.key)
+	switch entry.segment {
+	case segmentProbation:
+		p.move(entry, segmentProtected)
+		if protected := p.segments[segmentProtected]; protected.Len() > p.protectedCapacity() {
+			p.move(protected.Back().Value.(*cacheEntry), segmentProbation)
+		}
+	default:
+		p.segments[entry.segment].MoveToFront(entry.element)
+	}
+}
+
+func (p *tinyLFUPolicy) miss(key string)          { p.sketch.increment(key) }
+func (p *tinyLFUPolicy) remove(entry *cacheEntry) { p.segments[entry.segment].Remove(entry.element) }
+
+func (p *tinyLFUPolicy) reset() {
+	for _, segment := range p.segments {
+		segment.Init()
+	}
+}
+
+// mainVictim returns the least recently used entry of the main segments other than keep.
+func (p *tinyLFUPolicy) mainVictim(keep *cacheEntry) *cacheEntry {
+	for _, segment := range []int{segmentProbation, segmentProtected} {
+		for element := p.segments[segment].Back(); element != nil; element = element.Prev() {
+			if entry := element.Value.(*cacheEntry); entry != keep {
+				return entry
+			}
+		}
+	}
+	return nil
+}
+
+func (p *tinyLFUPolicy) victim(keep *cacheEntry) *cacheEntry {
+	window := p.segments[segmentWindow]
+	for window.Len() > p.windowCapacity() {
+		candidate := window.Back().Value.(*cacheEntry)
+		if candidate == keep {
+			break
+		}
+		victim := p.mainVictim(keep)
+		if victim != nil && p.sketch.estimate(candidate.key) <= p.sketch.estimate(victim.key) {
+			return candidate // not admitted
+		}
+		p.move(candidate, segmentProbation)
+		if victim != nil {
+			return victim
+		}
+	}
+
+	if victim := p.mainVictim(keep); victim != nil {
+		return victim
+	}
+	if back := window.Back(); back != nil && back.Value.(*cacheEntry) != keep {
+		return back.Value.(*cacheEntry)
+	}
+	return nil
+}
+
+// frequencySketch is a count-min sketch of 4-bit saturating counters estimating how often keys
+// were used. Counters are halved once the number of increments reaches ten times the width,
+// so the estimates follow recent use.
+type frequencySketch struct {
+	rows       [4][]uint8
+	mask       uint64
+	increments int
+	resetAt    int
+}
+
+// sketchSeeds derive the index of a key in each row from a single hash.
+var sketchSeeds = [4]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+func newFrequencySketch(capacity int) *frequencySketch {
+	width := 1024
+	for width < capacity {
+		width <<= 1
+	}
+
+	s := &frequencySketch{mask: uint64(width - 1), resetAt: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *frequencySketch) indexes(key string) [4]uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+	sum := hash.Sum64()
+
+	var indexes [4]uint64
+	for i, seed := range sketchSeeds {
+		h := sum * seed
+		indexes[i] = (h ^ h>>32) & s.mask
+	}
+	return indexes
+}
+
+func (s *frequencySketch) increment(key string) {
+	for i, index := range s.indexes(key) {
+		if s.rows[i][index] < 15 {
+			s.rows[i][index]++
+		}
+	}
+
+	if s.increments++; s.increments >= s.resetAt {
+		for _, row := range s.rows {
+			for i := range row {
+				row[i] >>= 1
+			}
+		}
+		s.increments /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(key string) uint8 {
+	estimate := uint8(15)
+	for i, index := range s.indexes(key) {
+		estimate = min(estimate, s.rows[i][index])
+	}
+	return estimate
+}
+
+// EstimateSize is the default Config.SizeFunc. It estimates the bytes held by an entry as the
+// length of its key plus the length of string and byte slice values, the width of numbers, or
+// the JSON encoded length of other values.
+func EstimateSize(key string, value any) int64 {
+	size := int64(len(key))
+	switch v := value.(type) {
+	case nil:
+	case string:
+		size += int64(len(v))
+	case []byte:
+		size += int64(len(v))
+	case bool, int8, uint8:
+		size++
+	case int16, uint16:
+		size += 2
+	case int32, uint32, float32:
+		size += 4
+	case int, int64, uint, uint64, uintptr, float64:
+		size += 8
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return size + 64 // rough guess for values that cannot be encoded
+		}
+		size += int64(len(data))
+	}
+	return size
+}
@@ -78,6 +78,15 @@ func TestInvalidateMethodPrefix(t *testing.T) {
 	if _, found := cache.Get(ctx, key3); !found {
 		t.Error("key3 should still exist (different state)")
 	}
+
+	// A cache without DeleteByPrefix cannot invalidate by prefix
+	unsupported := NewCachedBackend(backend, struct{ Cache }{cache}, 1*time.Minute)
+	if err := unsupported.InvalidateMethodPrefix(ctx, "FindStateFull", "state-456"); err == nil {
+		t.Error("expected an error for a cache without DeleteByPrefix")
+	}
+	if _, found := cache.Get(ctx, key3); !found {
+		t.Error("key3 should still exist after a failed invalidation")
+	}
 }
 
 // testPrefixBackend is a dummy backend for testing prefix invalidation
@@ -3,6 +3,7 @@ package cache
 import (
 	"container/heap"
 	"context"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,13 +11,19 @@ import (
 // LocalCache implements an in-memory cache with TTL support.
 // It uses a map for O(1) lookups and a background goroutine for periodic cleanup.
 // This implementation is thread-safe and suitable for single-instance applications.
-// For distributed systems, consider using Redis or similar distributed cache solutions.
+// For distributed systems, use RedisCache so every instance sees the same data.
+//
+// The cache can be bounded by Config.MaxEntries and Config.MaxBytes, in which case entries are
+// evicted according to Config.EvictionPolicy once a bound is reached. Reads of a bounded cache
+// update the policy, so they take the write lock.
 type LocalCache struct {
 	mu        sync.RWMutex           // Protects concurrent access to the items map
 	items     map[string]*cacheEntry // Stores all cached entries
 	itemsHeap cacheItemsHeap         // Min-heap to track expiration times
 	stopChan  chan struct{}          // Signal channel to stop the cleanup goroutine
 	config    *Config                // Configuration including default TTL
+	policy    evictionPolicy         // Orders entries for eviction, nil when unbounded
+	bytes     int64                  // Estimated size of all entries
 
 	//createChanMap sync.Map // map[string]chan struct{} allows us to create per-key channels for entry creation, to prevent master lock contention.
 }
@@ -35,12 +42,48 @@ func WithOptionCleanupInterval(interval time.Duration) Option {
 	}
 }
 
+// WithOptionMaxEntries bounds the number of entries.
+func WithOptionMaxEntries(maxEntries int) Option {
+	return func(c *LocalCache) {
+		c.config.MaxEntries = maxEntries
+	}
+}
+
+// WithOptionMaxBytes bounds the estimated size of the entries.
+func WithOptionMaxBytes(maxBytes int64) Option {
+	return func(c *LocalCache) {
+		c.config.MaxBytes = maxBytes
+	}
+}
+
+// WithOptionEvictionPolicy selects the entries evicted once a bound is reached.
+func WithOptionEvictionPolicy(policy EvictionPolicy) Option {
+	return func(c *LocalCache) {
+		c.config.EvictionPolicy = policy
+	}
+}
+
+// WithOptionSizeFunc sets how the size of entries is estimated.
+func WithOptionSizeFunc(sizeFunc func(key string, value any) int64) Option {
+	return func(c *LocalCache) {
+		c.config.SizeFunc = sizeFunc
+	}
+}
+
+// WithOptionOnEvict sets a callback for entries evicted by a bound or after their TTL.
+func WithOptionOnEvict(onEvict func(key string, value any, reason EvictionReason)) Option {
+	return func(c *LocalCache) {
+		c.config.OnEvict = onEvict
+	}
+}
+
 // NewLocalCacheWithOptions creates a new LocalCache instance with functional options.
 func NewLocalCacheWithOptions(options ...Option) *LocalCache {
-	localCache := NewLocalCache(nil)
+	localCache := newLocalCache(NewDefaultConfig())
 	for _, option := range options {
 		option(localCache)
 	}
+	localCache.start()
 	return localCache
 }
 
@@ -58,6 +101,13 @@ func NewLocalCache(config *Config) *LocalCache {
 		config = NewDefaultConfig()
 	}
 
+	cache := newLocalCache(config)
+	cache.start()
+	return cache
+}
+
+// newLocalCache creates a cache without starting it, so options can still change its config.
+func newLocalCache(config *Config) *LocalCache {
 	cache := &LocalCache{
 		items:     make(map[string]*cacheEntry),
 		itemsHeap: cacheItemsHeap{},
@@ -68,13 +118,15 @@ func NewLocalCache(config *Config) *LocalCache {
 		//createChanMap: sync.Map{},
 	}
 	heap.Init(&cache.itemsHeap) // Initialize the heap structure
-
-	// Start background cleanup goroutine
-	go cache.cleanupExpired()
-
 	return cache
 }
 
+// start sets up the eviction policy of the configured bounds and starts the background cleanup goroutine.
+func (c *LocalCache) start() {
+	c.policy = newEvictionPolicy(c.config, c.full)
+	go c.cleanupExpired()
+}
+
 // Len returns the number of items currently stored in the cache.
 func (c *LocalCache) Len() int {
 	c.mu.RLock()
@@ -83,6 +135,14 @@ func (c *LocalCache) Len() int {
 	return count
 }
 
+// Bytes returns the estimated size of the items currently stored in the cache. Sizes are only
+// estimated when the cache has a byte budget or a SizeFunc, otherwise it is 0.
+func (c *LocalCache) Bytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.bytes
+}
+
 //func (c *LocalCache) channelize(key string) chan struct{} {
 //	ch, _ := c.createChanMap.LoadOrStore(key, make(chan struct{}))
 //	return ch.(chan struct{})
@@ -90,7 +150,8 @@ func (c *LocalCache) Len() int {
 
 // Get retrieves a value from the cache.
 // It performs expiration checking and returns false for expired entries.
-// This method is thread-safe and uses read locks for better concurrent performance.
+// This method is thread-safe and uses read locks for better concurrent performance, unless the
+// cache is bounded and reads update the eviction policy.
 //
 // Parameters:
 //   - ctx: Context for the operation (currently unused but kept for interface compatibility)
@@ -100,6 +161,10 @@ func (c *LocalCache) Len() int {
 //   - value: The cached value if found and not expired
 //   - found: true if the key exists and hasn't expired, false otherwise
 func (c *LocalCache) Get(_ context.Context, key string) (any, bool) {
+	if c.policy != nil {
+		return c.getBounded(key)
+	}
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -117,26 +182,55 @@ func (c *LocalCache) Get(_ context.Context, key string) (any, bool) {
 	return entry.value, true
 }
 
+// getBounded is Get for bounded caches, recording the use of the entry in the eviction policy.
+func (c *LocalCache) getBounded(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.items[key]
+	if !exists || time.Now().After(entry.evictAt) {
+		c.policy.miss(key)
+		return nil, false
+	}
+
+	c.policy.access(entry)
+	return entry.value, true
+}
+
 // GetCreateOrUpdate retrieves a value from the cache or creates/updates it using fetchFunc.
 // It ensures thread-safe access and prevents cache stampedes by using locks.
 func (c *LocalCache) GetCreateOrUpdate(ctx context.Context, key string, fetchFunc func(exists bool, existingValue any) (any, error), ttl time.Duration) (any, error) {
-	c.mu.RLock() // First attempt to get the value from cache
-	entry, exists := c.items[key]
-	c.mu.RUnlock() // NOTE BEGIN : at this point the lock is released, so the entry could be modified by other goroutines
-
-	// if cache item exists and its not expired, return immediate
-	if exists && time.Now().Before(entry.evictAt) {
-		// Value found and not expired
-		return entry.value, nil
+	if c.policy != nil {
+		if value, found := c.getBounded(key); found {
+			return value, nil
+		}
+	} else {
+		c.mu.RLock() // First attempt to get the value from cache
+		entry, exists := c.items[key]
+		if exists && time.Now().Before(entry.evictAt) {
+			// Value found and not expired
+			c.mu.RUnlock()
+			return entry.value, nil
+		}
+		c.mu.RUnlock() // NOTE BEGIN : at this point the lock is released, so the entry could be modified by other goroutines
 	}
 
+	value, evicted, err := c.getCreateOrUpdate(key, fetchFunc, ttl)
+	c.notifyEvicted(evicted, EvictionCapacity)
+	return value, err
+}
+
+// getCreateOrUpdate fetches and stores the value of GetCreateOrUpdate under the write lock,
+// returning the entries evicted to make room for it.
+func (c *LocalCache) getCreateOrUpdate(key string, fetchFunc func(exists bool, existingValue any) (any, error), ttl time.Duration) (any, []*cacheEntry, error) {
 	// reacquire the master lock (TODO, optimize using per-key locks to prevent master lock contention)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	// double check since another go routine could have updated the cache while we read lock was released above
+	entry, exists := c.items[key]
 	if exists && time.Now().Before(entry.evictAt) {
-		return entry.value, nil // value found and not expired
+		return entry.value, nil, nil // value found and not expired
 	}
 
 	// currently held value or to be created valued
@@ -148,25 +242,30 @@ func (c *LocalCache) GetCreateOrUpdate(ctx context.Context, key string, fetchFun
 	// if the value exists, then it must be expired
 	value, err := fetchFunc(exists, value) // pass exists (essentially telling fetchFunc if this is a create or update)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if value == nil {
-		return nil, nil // do not cache nil values
+		return nil, nil, nil // do not cache nil values
 	}
 
-	if exists {
-		entry = c.update(key, value, ttl)
-	} else {
-		entry = c.add(key, value, ttl)
-	}
+	// the fetch holds the lock to prevent stampedes, so the new value is sized under it too
+	entry = c.set(key, value, c.sizeOf(key, value), ttl)
+	return value, c.evictOverLimits(entry), nil
+}
 
-	return entry.value, nil
+// set adds or updates a cache entry of the given size, as estimated by sizeOf.
+// It assumes the caller holds the write lock.
+func (c *LocalCache) set(key string, value any, size int64, ttl time.Duration) *cacheEntry {
+	if entry, exists := c.items[key]; exists {
+		return c.update(entry, value, size, ttl)
+	}
+	return c.add(key, value, size, ttl)
 }
 
 // add creates a new cache entry and adds it to the cache.
 // It assumes the caller holds the write lock.
-func (c *LocalCache) add(key string, value any, ttl time.Duration) *cacheEntry {
+func (c *LocalCache) add(key string, value any, size int64, ttl time.Duration) *cacheEntry {
 	// Use default TTL if none specified
 	if ttl == 0 {
 		ttl = c.config.DefaultTTL
@@ -176,25 +275,93 @@ func (c *LocalCache) add(key string, value any, ttl time.Duration) *cacheEntry {
 		key:     key,
 		value:   value,
 		evictAt: time.Now().Add(ttl),
+		size:    size,
 	}
 	c.items[key] = entry
 	heap.Push(&c.itemsHeap, entry)
+	c.bytes += entry.size
+	if c.policy != nil {
+		c.policy.add(entry)
+	}
 	return entry
 }
 
 // update modifies an existing cache entry with a new value and TTL.
 // It assumes the caller holds the write lock.
-func (c *LocalCache) update(key string, value any, ttl time.Duration) *cacheEntry {
+func (c *LocalCache) update(entry *cacheEntry, value any, size int64, ttl time.Duration) *cacheEntry {
 	if ttl == 0 {
 		ttl = c.config.DefaultTTL
 	}
-	entry := c.items[key]
+	c.bytes += size - entry.size
+
 	entry.evictAt = time.Now().Add(ttl)
 	entry.value = value
+	entry.size = size
 	heap.Fix(&c.itemsHeap, entry.index)
+	if c.policy != nil {
+		c.policy.access(entry)
+	}
 	return entry
 }
 
+// sizeOf estimates the size of an entry, if the cache has a byte budget or a SizeFunc.
+// Estimates may encode the value, call it before taking the lock where possible.
+func (c *LocalCache) sizeOf(key string, value any) int64 {
+	switch {
+	case c.config.SizeFunc != nil:
+		return c.config.SizeFunc(key, value)
+	case c.config.MaxBytes > 0:
+		return EstimateSize(key, value)
+	default:
+		return 0
+	}
+}
+
+// overLimits tells if the cache holds more entries or bytes than its bounds allow.
+// It assumes the caller holds the lock.
+func (c *LocalCache) overLimits() bool {
+	return (c.config.MaxEntries > 0 && len(c.items) > c.config.MaxEntries) ||
+		(c.config.MaxBytes > 0 && c.bytes > c.config.MaxBytes)
+}
+
+// full tells if the cache has reached its bounds.
+// It assumes the caller holds the lock.
+func (c *LocalCache) full() bool {
+	return (c.config.MaxEntries > 0 && len(c.items) >= c.config.MaxEntries) ||
+		(c.config.MaxBytes > 0 && c.bytes >= c.config.MaxBytes)
+}
+
+// evictOverLimits evicts entries chosen by the eviction policy until the cache is within its
+// bounds, returning the evicted entries. The entry just written is kept, unless it exceeds the
+// bounds by itself.
+// It assumes the caller holds the write lock.
+func (c *LocalCache) evictOverLimits(written *cacheEntry) []*cacheEntry {
+	var evicted []*cacheEntry
+	for c.policy != nil && c.overLimits() {
+		victim := c.policy.victim(written)
+		if victim == nil {
+			victim = written
+		}
+		c.remove(victim)
+		evicted = append(evicted, victim)
+		if victim == written {
+			break
+		}
+	}
+	return evicted
+}
+
+// notifyEvicted calls the OnEvict callback for evicted entries.
+// It must be called without holding the lock.
+func (c *LocalCache) notifyEvicted(evicted []*cacheEntry, reason EvictionReason) {
+	if c.config.OnEvict == nil {
+		return
+	}
+	for _, entry := range evicted {
+		c.config.OnEvict(entry.key, entry.value, reason)
+	}
+}
+
 // Set stores a value in the cache with the specified TTL.
 // If TTL is 0, the default TTL from the configuration is used.
 // This method overwrites any existing value for the same key.
@@ -208,21 +375,35 @@ func (c *LocalCache) update(key string, value any, ttl time.Duration) *cacheEntr
 // Returns:
 //   - error: Always nil for this implementation, but kept for interface compatibility
 func (c *LocalCache) Set(ctx context.Context, key string, value any, ttl time.Duration) {
+	size := c.sizeOf(key, value) // may encode the value, keep it out of the lock
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.add(key, value, ttl)
+	entry := c.set(key, value, size, ttl)
+	evicted := c.evictOverLimits(entry)
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted, EvictionCapacity)
 }
 
-// delete removes a specific key from the cache and ensures evict time is set to now.
+// delete removes a specific key from the cache.
 // It assumes the caller holds the write lock
 func (c *LocalCache) delete(key string) {
 	entry, ok := c.items[key]
 	if !ok {
 		return // key does not exist, noop
 	}
-	entry.evictAt = time.Now() // set eviction time to now
-	entry.value = nil
-	delete(c.items, key)
+	c.remove(entry)
+}
+
+// remove removes an entry from the items map, the expiration heap and the eviction policy.
+// It assumes the caller holds the write lock
+func (c *LocalCache) remove(entry *cacheEntry) {
+	delete(c.items, entry.key)
+	heap.Remove(&c.itemsHeap, entry.index)
+	c.bytes -= entry.size
+	if c.policy != nil {
+		c.policy.remove(entry)
+	}
 }
 
 // Delete removes a specific key from the cache.
@@ -253,19 +434,12 @@ func (c *LocalCache) DeleteByPrefix(ctx context.Context, prefix string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Collect keys to delete (can't delete while iterating)
-	keysToDelete := make([]string, 0)
-	for key := range c.items {
-		if len(key) >= len(prefix) && key[:len(prefix)] == prefix {
-			keysToDelete = append(keysToDelete, key)
+	for key, entry := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(entry) // deleting the current key while iterating is safe
 		}
 	}
 
-	// Delete the collected keys
-	for _, key := range keysToDelete {
-		delete(c.items, key)
-	}
-
 	return nil
 }
 
@@ -282,8 +456,13 @@ func (c *LocalCache) Clear(_ context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Create a new map to clear all entries
+	// Create a new map and heap to clear all entries
 	c.items = make(map[string]*cacheEntry)
+	c.itemsHeap = cacheItemsHeap{}
+	c.bytes = 0
+	if c.policy != nil {
+		c.policy.reset()
+	}
 	return nil
 }
 
@@ -296,35 +475,34 @@ func (c *LocalCache) cleanupExpired() {
 	defer ticker.Stop() // Ensure ticker is stopped when goroutine exits
 
 	evictFn := func() {
-		if c.itemsHeap.Len() == 0 {
-			return
-		}
-
 		now := time.Now()
 
 		// acquire read lock to peek at the heap, first item expired then acquire write lock to evict
+		// Peek at the item with the earliest eviction time
 		c.mu.RLock()
-		item := c.itemsHeap[0] // Peek at the item with the earliest eviction time
-		c.mu.RUnlock()         // Release read lock before acquiring write lock
+		expired := c.itemsHeap.Len() > 0 && !c.itemsHeap[0].evictAt.After(now)
+		c.mu.RUnlock() // Release read lock before acquiring write lock
 
 		// If the earliest item hasn't expired yet, nothing to do
-		if item.evictAt.After(now) {
+		if !expired {
 			return
 		}
 
 		// otherwise we obtain the master lock for eviction
 		c.mu.Lock()
-		defer c.mu.Unlock()
-
+		var evicted []*cacheEntry
 		// iterate and evict all expired items
 		for c.itemsHeap.Len() > 0 {
-			item = c.itemsHeap[0] // double check, item may have updated.
+			item := c.itemsHeap[0] // double check, item may have updated.
 			if item.evictAt.After(now) {
-				return
+				break
 			}
-			c.delete(item.key) // internal call with no lock.
-			heap.Pop(&c.itemsHeap)
+			c.remove(item) // internal call with no lock.
+			evicted = append(evicted, item)
 		}
+		c.mu.Unlock()
+
+		c.notifyEvicted(evicted, EvictionExpired)
 	}
 
 	for {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/require"
 	"log"
+	"strings"
 	"testing"
 	"time"
 )
@@ -150,3 +151,190 @@ func TestLocalCache_ConcurrentAccess(t *testing.T) {
 	<-done
 	<-done
 }
+
+func TestLocalCache_LRUEviction(t *testing.T) {
+	ctx := t.Context()
+
+	var evicted []string
+	cache := NewLocalCacheWithOptions(
+		WithOptionMaxEntries(3),
+		WithOptionOnEvict(func(key string, value any, reason EvictionReason) {
+			require.Equal(t, EvictionCapacity, reason)
+			evicted = append(evicted, key)
+		}),
+	)
+	defer cache.Close()
+
+	cache.Set(ctx, "a", 1, time.Minute)
+	cache.Set(ctx, "b", 2, time.Minute)
+	cache.Set(ctx, "c", 3, time.Minute)
+	_, found := cache.Get(ctx, "a") // b is now the least recently used
+	require.True(t, found)
+
+	cache.Set(ctx, "d", 4, time.Minute)
+	require.Equal(t, 3, cache.Len())
+	require.Equal(t, []string{"b"}, evicted)
+	_, found = cache.Get(ctx, "b")
+	require.False(t, found)
+
+	cache.Set(ctx, "c", 30, time.Minute) // updates count as a use
+	_, err := cache.GetCreateOrUpdate(ctx, "e", func(bool, any) (any, error) { return 5, nil }, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "a"}, evicted)
+}
+
+func TestLocalCache_LFUEviction(t *testing.T) {
+	ctx := t.Context()
+
+	cache := NewLocalCacheWithOptions(WithOptionMaxEntries(3), WithOptionEvictionPolicy(EvictionLFU))
+	defer cache.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set(ctx, key, key, time.Minute)
+	}
+	for range 3 {
+		cache.Get(ctx, "a")
+		cache.Get(ctx, "c")
+	}
+	cache.Get(ctx, "b")
+
+	cache.Set(ctx, "d", "d", time.Minute) // b is the least frequently used
+	_, found := cache.Get(ctx, "b")
+	require.False(t, found)
+
+	cache.Set(ctx, "e", "e", time.Minute) // d was used once, less than a and c
+	_, found = cache.Get(ctx, "d")
+	require.False(t, found)
+	for _, key := range []string{"a", "c", "e"} {
+		_, found := cache.Get(ctx, key)
+		require.True(t, found, key)
+	}
+}
+
+func TestLocalCache_TinyLFUResistsScans(t *testing.T) {
+	ctx := t.Context()
+
+	for _, policy := range []EvictionPolicy{EvictionLRU, EvictionTinyLFU} {
+		cache := NewLocalCacheWithOptions(WithOptionMaxEntries(100), WithOptionEvictionPolicy(policy))
+
+		// A working set of hot keys, used repeatedly.
+		for range 5 {
+			for i := range 50 {
+				key := fmt.Sprintf("hot:%d", i)
+				if _, found := cache.Get(ctx, key); !found {
+					cache.Set(ctx, key, i, time.Minute)
+				}
+			}
+		}
+		// A burst of distinct keys, each used once.
+		for i := range 1000 {
+			cache.Set(ctx, fmt.Sprintf("scan:%d", i), i, time.Minute)
+		}
+
+		hot := 0
+		for i := range 50 {
+			if _, found := cache.Get(ctx, fmt.Sprintf("hot:%d", i)); found {
+				hot++
+			}
+		}
+		require.Equal(t, 100, cache.Len())
+		if policy == EvictionTinyLFU {
+			require.GreaterOrEqual(t, hot, 45, "expected W-TinyLFU to keep the hot keys")
+		} else {
+			require.Zero(t, hot, "expected LRU to evict the hot keys")
+		}
+		cache.Close()
+	}
+}
+
+func TestLocalCache_MaxBytes(t *testing.T) {
+	ctx := t.Context()
+
+	cache := NewLocalCacheWithOptions(
+		WithOptionMaxBytes(100),
+		WithOptionSizeFunc(func(key string, value any) int64 { return int64(len(value.(string))) }),
+	)
+	defer cache.Close()
+
+	cache.Set(ctx, "a", strings.Repeat("a", 40), time.Minute)
+	cache.Set(ctx, "b", strings.Repeat("b", 40), time.Minute)
+	require.Equal(t, int64(80), cache.Bytes())
+
+	cache.Set(ctx, "a", strings.Repeat("a", 50), time.Minute) // growing a makes b the least recently used
+	require.Equal(t, int64(90), cache.Bytes())
+	cache.Set(ctx, "c", strings.Repeat("c", 30), time.Minute)
+	require.Equal(t, int64(80), cache.Bytes())
+	_, found := cache.Get(ctx, "b")
+	require.False(t, found)
+
+	cache.Set(ctx, "huge", strings.Repeat("h", 101), time.Minute)
+	require.Zero(t, cache.Len(), "an entry larger than the budget is not kept")
+	require.Zero(t, cache.Bytes())
+
+	cache.Set(ctx, "a", "a", time.Minute)
+	require.NoError(t, cache.DeleteByPrefix(ctx, "a"))
+	require.Zero(t, cache.Bytes())
+
+	require.Equal(t, int64(len("key")+len("value")), EstimateSize("key", "value"))
+	require.Equal(t, int64(len("key")+8), EstimateSize("key", 42))
+	require.Equal(t, int64(len("key")+len(`{"id":"u1","roles":null}`)), EstimateSize("key", cachedUser{ID: "u1"}))
+}
+
+func TestLocalCache_TinyLFUKeepsWrittenEntry(t *testing.T) {
+	ctx := t.Context()
+
+	cache := NewLocalCacheWithOptions(
+		WithOptionMaxBytes(10),
+		WithOptionEvictionPolicy(EvictionTinyLFU),
+		WithOptionSizeFunc(func(key string, value any) int64 { return int64(len(value.(string))) }),
+	)
+	defer cache.Close()
+
+	cache.Set(ctx, "a", "a", time.Minute)
+	cache.Set(ctx, "b", "b", time.Minute) // moves a out of the window
+	_, found := cache.Get(ctx, "a")       // and into the protected segment, as its only entry
+	require.True(t, found)
+
+	// growing a over the budget evicts b, not the entry just written
+	cache.Set(ctx, "a", strings.Repeat("a", 10), time.Minute)
+	_, found = cache.Get(ctx, "a")
+	require.True(t, found)
+	_, found = cache.Get(ctx, "b")
+	require.False(t, found)
+	require.Equal(t, int64(10), cache.Bytes())
+}
+
+func TestLocalCache_ExpiredEntriesAreEvicted(t *testing.T) {
+	ctx := t.Context()
+
+	expired := make(chan string, 10)
+	cache := NewLocalCacheWithOptions(
+		WithOptionCleanupInterval(20*time.Millisecond),
+		WithOptionMaxEntries(10),
+		WithOptionOnEvict(func(key string, value any, reason EvictionReason) {
+			require.Equal(t, EvictionExpired, reason)
+			expired <- key
+		}),
+	)
+	defer cache.Close()
+
+	cache.Set(ctx, "short", 1, 50*time.Millisecond)
+	cache.Set(ctx, "renewed", 1, 50*time.Millisecond)
+	cache.Set(ctx, "renewed", 2, time.Minute) // the renewed TTL replaces the first one
+	cache.Set(ctx, "deleted", 1, 50*time.Millisecond)
+	cache.Delete(ctx, "deleted")
+
+	select {
+	case key := <-expired:
+		require.Equal(t, "short", key)
+	case <-time.After(time.Second):
+		t.Fatal("expected the expired entry to be evicted")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, expired)
+	value, found := cache.Get(ctx, "renewed")
+	require.True(t, found)
+	require.Equal(t, 2, value)
+	require.Equal(t, 1, cache.Len())
+}
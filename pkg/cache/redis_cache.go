@@ -0,0 +1,327 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unlockScript deletes a lock only if it still holds the token of its owner, so a lock that
+// expired and was taken by another process is not released.
+const unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+
+// RedisCache implements Cache on a server speaking the Redis protocol (Redis, Valkey, KeyDB, ...),
+// so every instance of a service shares the cached data and sees invalidations right away.
+// Values are serialized with the configured Serializer and expire through server side TTLs.
+// All keys are stored under a key prefix, which bounds what Clear and DeleteByPrefix remove.
+//
+// Operations that cannot return an error (Get, Set, Delete) log failures; a failed Get is a miss.
+type RedisCache struct {
+	pool       *respPool
+	config     *Config
+	prefix     string
+	serializer Serializer
+	lockTTL    time.Duration
+	lockWait   time.Duration
+}
+
+// RedisOption configures a RedisCache.
+type RedisOption func(*RedisCache)
+
+// WithRedisPassword authenticates connections with password.
+func WithRedisPassword(password string) RedisOption {
+	return func(c *RedisCache) {
+		c.pool.password = password
+	}
+}
+
+// WithRedisDB selects the logical database of the server.
+func WithRedisDB(db int) RedisOption {
+	return func(c *RedisCache) {
+		c.pool.db = db
+	}
+}
+
+// WithRedisKeyPrefix sets the prefix of every key stored by the cache, "cache:" by default.
+func WithRedisKeyPrefix(prefix string) RedisOption {
+	return func(c *RedisCache) {
+		c.prefix = prefix
+	}
+}
+
+// WithRedisPoolSize sets how many idle connections are kept open, 10 by default.
+func WithRedisPoolSize(size int) RedisOption {
+	return func(c *RedisCache) {
+		c.pool.idle = make(chan *respConn, size)
+	}
+}
+
+// WithRedisTimeout bounds dialing and each command, 5s by default.
+func WithRedisTimeout(timeout time.Duration) RedisOption {
+	return func(c *RedisCache) {
+		c.pool.timeout = timeout
+	}
+}
+
+// WithRedisSerializer replaces the default JSONSerializer.
+func WithRedisSerializer(serializer Serializer) RedisOption {
+	return func(c *RedisCache) {
+		c.serializer = serializer
+	}
+}
+
+// WithRedisLock configures the distributed lock of GetCreateOrUpdate: ttl bounds how long a
+// fetch holds the lock, 10s by default, and wait how long other callers wait for its result
+// before fetching themselves, 5s by default.
+func WithRedisLock(ttl, wait time.Duration) RedisOption {
+	return func(c *RedisCache) {
+		c.lockTTL, c.lockWait = ttl, wait
+	}
+}
+
+// NewRedisCache creates a cache on the server at addr (host:port). Connections are opened on
+// demand, use Ping to check the server is reachable.
+//
+// Parameters:
+//   - addr: Address of the server
+//   - config: Cache configuration. If nil, default configuration is used.
+//   - options: Connection, key prefix, serialization and locking options
+func NewRedisCache(addr string, config *Config, options ...RedisOption) *RedisCache {
+	if config == nil {
+		config = NewDefaultConfig()
+	}
+
+	c := &RedisCache{
+		pool: &respPool{
+			addr:    addr,
+			timeout: 5 * time.Second,
+			idle:    make(chan *respConn, 10),
+		},
+		config:     config,
+		prefix:     "cache:",
+		serializer: NewJSONSerializer(),
+		lockTTL:    10 * time.Second,
+		lockWait:   5 * time.Second,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// RegisterType registers the type of sample with the serializer, if it restores registered types
+// such as JSONSerializer, so values of that type cached by other processes are decoded with it.
+func (c *RedisCache) RegisterType(sample any) {
+	if registry, ok := c.serializer.(typeRegistry); ok {
+		registry.RegisterType(sample)
+	}
+}
+
+// Ping checks that the server is reachable.
+func (c *RedisCache) Ping(ctx context.Context) error {
+	_, err := c.pool.do(ctx, "PING")
+	return err
+}
+
+// Get retrieves and deserializes a value from the cache.
+// Returns false if the key does not exist, has expired or cannot be read.
+func (c *RedisCache) Get(ctx context.Context, key string) (any, bool) {
+	value, found, err := c.get(ctx, key)
+	if err != nil {
+		log.Printf("failed to get cache key %s: %v", key, err)
+		return nil, false
+	}
+	return value, found
+}
+
+func (c *RedisCache) get(ctx context.Context, key string) (any, bool, error) {
+	reply, err := c.pool.do(ctx, "GET", c.prefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected GET reply %T", reply)
+	}
+	value, err := c.serializer.Unmarshal(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// GetCreateOrUpdate retrieves a value from the cache, or fetches and caches it with fetchFunc if
+// it is missing. Across all instances sharing the server, only the holder of a per-key lock runs
+// fetchFunc while the others wait for its result, preventing cache stampedes. If the result does
+// not show up within the lock wait, callers fetch it themselves. Since the server evicts expired
+// keys, fetchFunc is always told the value does not exist.
+func (c *RedisCache) GetCreateOrUpdate(ctx context.Context, key string, fetchFunc func(exists bool, value any) (any, error), ttl time.Duration) (any, error) {
+	if value, found := c.Get(ctx, key); found {
+		return value, nil
+	}
+
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	lockKey := "lock:" + c.prefix + key // outside the key prefix, so Clear leaves locks alone
+	lockTTL := strconv.FormatInt(c.lockTTL.Milliseconds(), 10)
+
+	waitUntil := time.Now().Add(c.lockWait)
+	for {
+		reply, err := c.pool.do(ctx, "SET", lockKey, token, "NX", "PX", lockTTL)
+		if err != nil {
+			log.Printf("failed to lock cache key %s, fetching without lock: %v", key, err)
+			return c.fetch(ctx, key, fetchFunc, ttl)
+		}
+		if reply != nil {
+			break // lock acquired
+		}
+
+		// Another caller is fetching the value, wait for it to be cached.
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+		if value, found := c.Get(ctx, key); found {
+			return value, nil
+		}
+		if time.Now().After(waitUntil) {
+			log.Printf("timed out waiting for the lock of cache key %s, fetching without lock", key)
+			return c.fetch(ctx, key, fetchFunc, ttl)
+		}
+	}
+
+	defer func() {
+		if _, err := c.pool.do(context.WithoutCancel(ctx), "EVAL", unlockScript, "1", lockKey, token); err != nil {
+			log.Printf("failed to unlock cache key %s: %v", key, err)
+		}
+	}()
+
+	// Double check, the previous lock holder may have cached the value meanwhile.
+	if value, found := c.Get(ctx, key); found {
+		return value, nil
+	}
+	return c.fetch(ctx, key, fetchFunc, ttl)
+}
+
+func (c *RedisCache) fetch(ctx context.Context, key string, fetchFunc func(exists bool, value any) (any, error), ttl time.Duration) (any, error) {
+	value, err := fetchFunc(false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil // do not cache nil values
+	}
+	c.Set(ctx, key, value, ttl)
+	return value, nil
+}
+
+// lockToken returns a random token identifying a lock owner.
+func lockToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// Set serializes and stores a value with the specified TTL.
+// If TTL is 0, the default TTL from the configuration is used.
+func (c *RedisCache) Set(ctx context.Context, key string, value any, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = c.config.DefaultTTL
+	}
+
+	data, err := c.serializer.Marshal(value)
+	if err != nil {
+		log.Printf("failed to set cache key %s: %v", key, err)
+		return
+	}
+	if _, err := c.pool.do(ctx, "SET", c.prefix+key, string(data), "PX", strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+		log.Printf("failed to set cache key %s: %v", key, err)
+	}
+}
+
+// Delete removes a specific key from the cache.
+// This operation is idempotent - deleting a non-existent key is not an error.
+func (c *RedisCache) Delete(ctx context.Context, key string) {
+	if _, err := c.pool.do(ctx, "DEL", c.prefix+key); err != nil {
+		log.Printf("failed to delete cache key %s: %v", key, err)
+	}
+}
+
+// DeleteByPrefix removes all cache entries whose keys start with the given prefix. Keys are
+// listed with SCAN, so the server is not blocked, and entries added meanwhile may be missed.
+func (c *RedisCache) DeleteByPrefix(ctx context.Context, prefix string) error {
+	pattern := escapeGlob(c.prefix+prefix) + "*"
+	cursor := "0"
+	for {
+		reply, err := c.pool.do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "100")
+		if err != nil {
+			return fmt.Errorf("failed to scan cache keys with prefix %s: %w", prefix, err)
+		}
+
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return fmt.Errorf("unexpected SCAN reply %v", reply)
+		}
+		next, _ := page[0].([]byte)
+		keys, _ := page[1].([]any)
+
+		if len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, key := range keys {
+				if name, ok := key.([]byte); ok {
+					args = append(args, string(name))
+				}
+			}
+			if _, err := c.pool.do(ctx, args...); err != nil {
+				return fmt.Errorf("failed to delete cache keys with prefix %s: %w", prefix, err)
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// escapeGlob escapes the characters of s that SCAN MATCH patterns interpret.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Clear removes all entries stored under the key prefix of the cache, leaving other keys of the
+// server untouched.
+func (c *RedisCache) Clear(ctx context.Context) error {
+	return c.DeleteByPrefix(ctx, "")
+}
+
+// GetDefaultTTL returns the default TTL configured for this cache.
+func (c *RedisCache) GetDefaultTTL() time.Duration {
+	if c.config != nil {
+		return c.config.DefaultTTL
+	}
+	return 5 * time.Minute // Fallback default
+}
+
+// Close closes the idle connections to the server.
+func (c *RedisCache) Close() {
+	c.pool.close()
+}
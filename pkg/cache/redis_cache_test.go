@@ -0,0 +1,331 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// respServer is an in-process server implementing the subset of the Redis protocol used by RedisCache.
+type respServer struct {
+	ln     net.Listener
+	mu     sync.Mutex
+	data   map[string]respEntry
+	scans  map[string][]string // keys left to return by SCAN cursor
+	cursor int
+}
+
+type respEntry struct {
+	value    string
+	expireAt time.Time
+}
+
+func newRESPServer(t *testing.T) *respServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &respServer{ln: ln, data: make(map[string]respEntry), scans: make(map[string][]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *respServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *respServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		command, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range command.([]any) {
+			args = append(args, string(arg.([]byte)))
+		}
+		w.WriteString(s.exec(args))
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// live returns the value of key, if it exists and has not expired; s.mu must be held.
+func (s *respServer) live(key string) (string, bool) {
+	entry, found := s.data[key]
+	if !found || (!entry.expireAt.IsZero() && time.Now().After(entry.expireAt)) {
+		return "", false
+	}
+	return entry.value, true
+}
+
+func (s *respServer) exec(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bulk := func(value string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value) }
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		if value, found := s.live(args[1]); found {
+			return bulk(value)
+		}
+		return "$-1\r\n"
+	case "SET":
+		entry := respEntry{value: args[2]}
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if _, found := s.live(args[1]); found {
+					return "$-1\r\n"
+				}
+			case "PX":
+				ms, _ := strconv.Atoi(args[i+1])
+				entry.expireAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+				i++
+			}
+		}
+		s.data[args[1]] = entry
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, found := s.live(key); found {
+				deleted++
+			}
+			delete(s.data, key)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "SCAN":
+		// only "<escaped prefix>*" patterns are supported, served two keys per page from a
+		// snapshot taken by the first call, so keys deleted between pages do not shift the cursor
+		keys := s.scans[args[1]]
+		if args[1] == "0" {
+			prefix := strings.TrimSuffix(args[3], "*")
+			prefix = strings.NewReplacer(`\*`, "*", `\?`, "?", `\[`, "[", `\]`, "]", `\\`, `\`).Replace(prefix)
+			keys = nil
+			for key := range s.data {
+				if _, found := s.live(key); found && strings.HasPrefix(key, prefix) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+		}
+		page := keys[:min(2, len(keys))]
+		next := "0"
+		if len(keys) > len(page) {
+			s.cursor++
+			next = strconv.Itoa(s.cursor)
+			s.scans[next] = keys[len(page):]
+		}
+		reply := "*2\r\n" + bulk(next) + fmt.Sprintf("*%d\r\n", len(page))
+		for _, key := range page {
+			reply += bulk(key)
+		}
+		return reply
+	case "EVAL":
+		if args[1] != unlockScript {
+			return "-ERR unsupported script\r\n"
+		}
+		if value, found := s.live(args[3]); found && value == args[4] {
+			delete(s.data, args[3])
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+type cachedUser struct {
+	ID    string   `json:"id"`
+	Roles []string `json:"roles"`
+}
+
+func TestRedisCache_SetAndGet(t *testing.T) {
+	ctx := t.Context()
+	server := newRESPServer(t)
+
+	writer := NewRedisCache(server.addr(), nil)
+	defer writer.Close()
+	require.NoError(t, writer.Ping(ctx))
+
+	user := &cachedUser{ID: "u1", Roles: []string{"admin"}}
+	writer.Set(ctx, "user:u1", user, time.Minute)
+	writer.Set(ctx, "count", 42, time.Minute)
+
+	value, found := writer.Get(ctx, "user:u1")
+	require.True(t, found)
+	require.Equal(t, user, value, "values are restored with their type")
+
+	// A reader that never cached the type decodes it as generic JSON until it is registered,
+	// as CallCached does for its result type.
+	serializer := NewJSONSerializer()
+	reader := NewRedisCache(server.addr(), nil, WithRedisSerializer(serializer))
+	defer reader.Close()
+
+	value, found = reader.Get(ctx, "user:u1")
+	require.True(t, found)
+	require.Equal(t, map[string]any{"id": "u1", "roles": []any{"admin"}}, value)
+
+	serializer.RegisterType(&cachedUser{})
+	value, found = reader.Get(ctx, "user:u1")
+	require.True(t, found)
+	require.Equal(t, user, value)
+
+	reader.Delete(ctx, "user:u1")
+	_, found = writer.Get(ctx, "user:u1")
+	require.False(t, found, "deletes are seen by every instance")
+
+	value, found = writer.Get(ctx, "count")
+	require.True(t, found)
+	require.Equal(t, 42, value)
+}
+
+func TestCallCached_AcrossInstances(t *testing.T) {
+	ctx := t.Context()
+	server := newRESPServer(t)
+
+	// each instance has its own serializer, as separate processes would
+	newInstance := func() *CachedBackend {
+		redis := NewRedisCache(server.addr(), nil)
+		t.Cleanup(redis.Close)
+		return NewCachedBackend(&mockBackend{}, redis, time.Minute)
+	}
+	writer, reader := newInstance(), newInstance()
+
+	user := cachedUser{ID: "u1", Roles: []string{"admin"}}
+	fetched, err := CallCached(writer, ctx, "FindUser", []any{"u1"}, func() (cachedUser, error) { return user, nil })
+	require.NoError(t, err)
+	require.Equal(t, user, fetched)
+	_, err = CallCachedWithTTL(writer, ctx, "FindUserRef", []any{"u1"}, time.Minute, func() (*cachedUser, error) { return &user, nil })
+	require.NoError(t, err)
+
+	// the reader is served from the shared cache without fetching
+	cached, err := CallCached(reader, ctx, "FindUser", []any{"u1"}, func() (cachedUser, error) {
+		return cachedUser{}, errors.New("fetched despite a shared cache hit")
+	})
+	require.NoError(t, err)
+	require.Equal(t, user, cached)
+
+	cachedRef, err := CallCachedWithTTL(reader, ctx, "FindUserRef", []any{"u1"}, time.Minute, func() (*cachedUser, error) {
+		return nil, errors.New("fetched despite a shared cache hit")
+	})
+	require.NoError(t, err)
+	require.Equal(t, &user, cachedRef)
+}
+
+func TestRedisCache_Expiration(t *testing.T) {
+	ctx := t.Context()
+	server := newRESPServer(t)
+
+	cache := NewRedisCache(server.addr(), NewConfigWithTTL(50*time.Millisecond))
+	defer cache.Close()
+
+	cache.Set(ctx, "short", "value", 0)
+	_, found := cache.Get(ctx, "short")
+	require.True(t, found)
+
+	time.Sleep(100 * time.Millisecond)
+	_, found = cache.Get(ctx, "short")
+	require.False(t, found, "expected the default TTL to expire the entry")
+}
+
+func TestRedisCache_DeleteByPrefixAndClear(t *testing.T) {
+	ctx := t.Context()
+	server := newRESPServer(t)
+
+	cache := NewRedisCache(server.addr(), nil, WithRedisKeyPrefix("svc:"))
+	defer cache.Close()
+	other := NewRedisCache(server.addr(), nil, WithRedisKeyPrefix("other:"))
+	defer other.Close()
+
+	for i := range 5 {
+		cache.Set(ctx, fmt.Sprintf("FindUser:%d", i), i, time.Minute)
+	}
+	cache.Set(ctx, "FindProject:1", 1, time.Minute)
+	cache.Set(ctx, "Find*:1", 1, time.Minute)
+	other.Set(ctx, "FindUser:1", 1, time.Minute)
+
+	require.NoError(t, cache.DeleteByPrefix(ctx, "FindUser:"))
+	for i := range 5 {
+		_, found := cache.Get(ctx, fmt.Sprintf("FindUser:%d", i))
+		require.False(t, found)
+	}
+	_, found := cache.Get(ctx, "FindProject:1")
+	require.True(t, found)
+
+	require.NoError(t, cache.DeleteByPrefix(ctx, "Find*"))
+	_, found = cache.Get(ctx, "Find*:1")
+	require.False(t, found)
+	_, found = cache.Get(ctx, "FindProject:1")
+	require.True(t, found, "glob characters in the prefix are matched literally")
+
+	require.NoError(t, cache.Clear(ctx))
+	_, found = cache.Get(ctx, "FindProject:1")
+	require.False(t, found)
+	_, found = other.Get(ctx, "FindUser:1")
+	require.True(t, found, "clear only removes keys under the cache prefix")
+}
+
+func TestRedisCache_GetCreateOrUpdateStampede(t *testing.T) {
+	ctx := t.Context()
+	server := newRESPServer(t)
+
+	// Two instances, as in two pods, share the server.
+	caches := []*RedisCache{NewRedisCache(server.addr(), nil), NewRedisCache(server.addr(), nil)}
+	for _, cache := range caches {
+		defer cache.Close()
+	}
+
+	var fetches atomic.Int32
+	var wg sync.WaitGroup
+	results := make(chan any, 20)
+	for i := range 20 {
+		wg.Add(1)
+		go func(cache *RedisCache) {
+			defer wg.Done()
+			value, err := cache.GetCreateOrUpdate(ctx, "expensive", func(exists bool, value any) (any, error) {
+				fetches.Add(1)
+				time.Sleep(100 * time.Millisecond)
+				return "computed", nil
+			}, time.Minute)
+			require.NoError(t, err)
+			results <- value
+		}(caches[i%2])
+	}
+	wg.Wait()
+	close(results)
+
+	require.Equal(t, int32(1), fetches.Load(), "expected a single fetch across instances")
+	for value := range results {
+		require.Equal(t, "computed", value)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	_, locked := server.live("lock:cache:expensive")
+	require.False(t, locked, "expected the lock to be released")
+}
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// respError is an error reply of the server, which leaves the connection usable.
+type respError string
+
+func (e respError) Error() string { return string(e) }
+
+// respConn is a connection speaking the Redis serialization protocol (RESP2).
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// do sends a command and reads its reply: a string for simple strings, int64 for integers,
+// []byte or nil for bulk strings, []any or nil for arrays, and a respError for error replies.
+func (c *respConn) do(ctx context.Context, timeout time.Duration, args ...string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to send %s command: %w", args[0], err)
+	}
+
+	reply, err := readReply(c.r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s reply: %w", args[0], err)
+	}
+	if replyErr, ok := reply.(respError); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+func (c *respConn) close() {
+	_ = c.conn.Close()
+}
+
+// readReply reads one RESP2 value.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply line %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return respError(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < 0 {
+			return nil, err // a null bulk string is a nil reply
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil || count < 0 {
+			return nil, err // a null array is a nil reply
+		}
+		values := make([]any, count)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", kind)
+	}
+}
+
+// respPool keeps idle connections to a RESP server, dialing new ones on demand.
+type respPool struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	idle     chan *respConn
+	closed   atomic.Bool
+}
+
+func (p *respPool) get(ctx context.Context) (*respConn, error) {
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: p.timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cache server %s: %w", p.addr, err)
+	}
+
+	conn := &respConn{conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+	if p.password != "" {
+		if _, err := conn.do(ctx, p.timeout, "AUTH", p.password); err != nil {
+			conn.close()
+			return nil, fmt.Errorf("failed to authenticate to cache server %s: %w", p.addr, err)
+		}
+	}
+	if p.db != 0 {
+		if _, err := conn.do(ctx, p.timeout, "SELECT", strconv.Itoa(p.db)); err != nil {
+			conn.close()
+			return nil, fmt.Errorf("failed to select database %d: %w", p.db, err)
+		}
+	}
+	return conn, nil
+}
+
+// put returns a connection to the pool, closing it if the command failed on the connection
+// itself or the pool is full.
+func (p *respPool) put(conn *respConn, err error) {
+	var replyErr respError
+	if p.closed.Load() || (err != nil && !errors.As(err, &replyErr)) {
+		conn.close()
+		return
+	}
+
+	select {
+	case p.idle <- conn:
+	default:
+		conn.close()
+	}
+}
+
+// do runs a command on a pooled connection.
+func (p *respPool) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(ctx, p.timeout, args...)
+	p.put(conn, err)
+	return reply, err
+}
+
+func (p *respPool) close() {
+	p.closed.Store(true)
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Serializer converts cache values to and from bytes for networked cache backends.
+type Serializer interface {
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte) (any, error)
+}
+
+// typeRegistry is implemented by serializers and caches that restore values with their Go type
+// once it is registered, such as JSONSerializer. CallCached registers its result type through it.
+type typeRegistry interface {
+	RegisterType(sample any)
+}
+
+// typedValue is the stored form of a value serialized by JSONSerializer.
+type typedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONSerializer stores values as JSON tagged with their Go type, so they are restored with the
+// same type, as CallCached expects, when the reading process knows it. Types are learnt from the
+// values marshalled, registered upfront with RegisterType, or by CallCached for its result type;
+// values of unknown types are decoded as generic JSON (map[string]any, []any, float64, ...).
+type JSONSerializer struct {
+	types sync.Map // type name -> reflect.Type
+}
+
+// NewJSONSerializer creates a JSONSerializer.
+func NewJSONSerializer() *JSONSerializer {
+	return &JSONSerializer{}
+}
+
+// RegisterType makes values of the type of sample, e.g. &models.User{}, decodable before this
+// process cached one itself.
+func (s *JSONSerializer) RegisterType(sample any) {
+	t := reflect.TypeOf(sample)
+	s.types.Store(typeName(t), t)
+}
+
+// Marshal encodes value as JSON tagged with its type.
+func (s *JSONSerializer) Marshal(value any) ([]byte, error) {
+	if value == nil {
+		return nil, fmt.Errorf("cannot cache a nil value")
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cache value: %w", err)
+	}
+
+	t := reflect.TypeOf(value)
+	s.types.Store(typeName(t), t)
+	return json.Marshal(typedValue{Type: typeName(t), Value: data})
+}
+
+// Unmarshal decodes a value encoded by Marshal, restoring its type if it is known.
+func (s *JSONSerializer) Unmarshal(data []byte) (any, error) {
+	var typed typedValue
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache value: %w", err)
+	}
+
+	known, found := s.types.Load(typed.Type)
+	if !found {
+		var value any
+		if err := json.Unmarshal(typed.Value, &value); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cache value of type %s: %w", typed.Type, err)
+		}
+		return value, nil
+	}
+
+	ptr := reflect.New(known.(reflect.Type))
+	if err := json.Unmarshal(typed.Value, ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache value of type %s: %w", typed.Type, err)
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// typeName names t by its package path, so types of different packages with the same name are
+// told apart.
+func typeName(t reflect.Type) string {
+	switch {
+	case t.Kind() == reflect.Pointer:
+		return "*" + typeName(t.Elem())
+	case t.Name() != "" && t.PkgPath() != "":
+		return t.PkgPath() + "." + t.Name()
+	default:
+		return t.String()
+	}
+}
@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+)
+
+// Operations of an Invalidation.
+const (
+	InvalidateKeys   = "keys"
+	InvalidatePrefix = "prefix"
+	InvalidateAll    = "all"
+)
+
+// Invalidation is broadcast by a TieredCache to its peers when entries change, so they evict
+// them from their local tier.
+type Invalidation struct {
+	Node   string   `json:"node"`             // node that changed the entries, which ignores its own broadcasts
+	Op     string   `json:"op"`               // InvalidateKeys, InvalidatePrefix or InvalidateAll
+	Keys   []string `json:"keys,omitempty"`   // keys of an InvalidateKeys invalidation
+	Prefix string   `json:"prefix,omitempty"` // key prefix of an InvalidatePrefix invalidation
+}
+
+// TieredCache layers an in-process LocalCache (L1) over a shared cache (L2) such as RedisCache,
+// serving hot keys at in-process latency. Reads fill L1 from L2; writes and deletes go to both
+// tiers and are broadcast over the invalidation route, so peer nodes evict the entries from their
+// L1. L1 entries also expire after the local TTL, which bounds staleness if a broadcast is lost.
+//
+// Wiring a node:
+//
+//	tiered := cache.NewTieredCache(redisCache, nil)
+//	invalidations := factory.NewRoute(invalidationConfig, tiered.HandleInvalidation)
+//	tiered.SetInvalidationRoute(invalidations)
+//	err := invalidations.Subscribe(ctx)
+//
+// The invalidation route must deliver every message to every node: use a subject without a queue group.
+type TieredCache struct {
+	local    *LocalCache
+	remote   Cache
+	localTTL time.Duration
+	node     string
+
+	mu    sync.RWMutex
+	route routing.Route
+}
+
+// NewTieredCache creates a cache layering a new LocalCache over remote. L1 entries live for at
+// most localTTL, or 30 seconds if zero, even when L2 keeps them longer.
+func NewTieredCache(remote Cache, config *Config, localTTL ...time.Duration) *TieredCache {
+	c := &TieredCache{
+		local:    NewLocalCache(config),
+		remote:   remote,
+		localTTL: 30 * time.Second,
+		node:     uuid.NewString(),
+	}
+	if len(localTTL) > 0 && localTTL[0] > 0 {
+		c.localTTL = localTTL[0]
+	}
+	return c
+}
+
+// SetInvalidationRoute sets the route invalidations are broadcast on. Subscribe the route with
+// HandleInvalidation as its callback to receive the invalidations of peers.
+func (c *TieredCache) SetInvalidationRoute(route routing.Route) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.route = route
+}
+
+// HandleInvalidation is the route callback evicting the entries invalidated by peers from L1.
+func (c *TieredCache) HandleInvalidation(ctx context.Context, msg routing.MessageEnvelop) {
+	var invalidation Invalidation
+	if err := msg.Decode(&invalidation); err != nil {
+		log.Printf("failed to decode cache invalidation: %v", err)
+		_ = msg.Term(ctx)
+		return
+	}
+	if invalidation.Node != c.node {
+		c.evict(ctx, invalidation)
+	}
+	if _, err := msg.Metadata(); err == nil { // core messages cannot be acknowledged
+		_ = msg.Ack(ctx)
+	}
+}
+
+// evict removes invalidated entries from L1.
+func (c *TieredCache) evict(ctx context.Context, invalidation Invalidation) {
+	switch invalidation.Op {
+	case InvalidateKeys:
+		for _, key := range invalidation.Keys {
+			c.local.Delete(ctx, key)
+		}
+	case InvalidatePrefix:
+		_ = c.local.DeleteByPrefix(ctx, invalidation.Prefix)
+	case InvalidateAll:
+		_ = c.local.Clear(ctx)
+	default:
+		log.Printf("unknown cache invalidation: %s", invalidation.Op)
+	}
+}
+
+// broadcast publishes an invalidation to the peers, if an invalidation route is set.
+func (c *TieredCache) broadcast(ctx context.Context, invalidation Invalidation) {
+	c.mu.RLock()
+	route := c.route
+	c.mu.RUnlock()
+	if route == nil {
+		return
+	}
+
+	invalidation.Node = c.node
+	if err := route.Publish(ctx, invalidation); err != nil {
+		log.Printf("failed to broadcast cache invalidation %s: %v", invalidation.Op, err)
+	}
+}
+
+// localTTLFor caps ttl at the local TTL.
+func (c *TieredCache) localTTLFor(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > c.localTTL {
+		return c.localTTL
+	}
+	return ttl
+}
+
+// RegisterType registers the type of sample with the shared tier, if it restores registered types.
+func (c *TieredCache) RegisterType(sample any) {
+	if registry, ok := c.remote.(typeRegistry); ok {
+		registry.RegisterType(sample)
+	}
+}
+
+// Get retrieves a value from L1, or from L2, filling L1 on a hit.
+func (c *TieredCache) Get(ctx context.Context, key string) (any, bool) {
+	if value, found := c.local.Get(ctx, key); found {
+		return value, true
+	}
+
+	value, found := c.remote.Get(ctx, key)
+	if found {
+		c.local.Set(ctx, key, value, c.localTTL)
+	}
+	return value, found
+}
+
+// GetCreateOrUpdate retrieves a value from L1, or from L2 which fetches it with fetchFunc if it
+// is missing there too, with the stampede protection of L2. The value is then kept in L1.
+func (c *TieredCache) GetCreateOrUpdate(ctx context.Context, key string, fetchFunc func(exists bool, value any) (any, error), ttl time.Duration) (any, error) {
+	if value, found := c.local.Get(ctx, key); found {
+		return value, nil
+	}
+
+	value, err := c.remote.GetCreateOrUpdate(ctx, key, fetchFunc, ttl)
+	if err != nil || value == nil {
+		return value, err
+	}
+	c.local.Set(ctx, key, value, c.localTTLFor(ttl))
+	return value, nil
+}
+
+// Set stores a value in both tiers and evicts the stale value of the key from the L1 of peers.
+func (c *TieredCache) Set(ctx context.Context, key string, value any, ttl time.Duration) {
+	c.remote.Set(ctx, key, value, ttl)
+	c.local.Set(ctx, key, value, c.localTTLFor(ttl))
+	c.broadcast(ctx, Invalidation{Op: InvalidateKeys, Keys: []string{key}})
+}
+
+// Delete removes a key from both tiers and from the L1 of peers.
+func (c *TieredCache) Delete(ctx context.Context, key string) {
+	c.remote.Delete(ctx, key)
+	c.local.Delete(ctx, key)
+	c.broadcast(ctx, Invalidation{Op: InvalidateKeys, Keys: []string{key}})
+}
+
+// DeleteByPrefix removes the entries whose keys start with prefix from both tiers, when L2
+// supports it, and from the L1 of peers.
+func (c *TieredCache) DeleteByPrefix(ctx context.Context, prefix string) error {
+	var err error
+	if deleter, ok := c.remote.(interface {
+		DeleteByPrefix(context.Context, string) error
+	}); ok {
+		err = deleter.DeleteByPrefix(ctx, prefix)
+	}
+	_ = c.local.DeleteByPrefix(ctx, prefix)
+	c.broadcast(ctx, Invalidation{Op: InvalidatePrefix, Prefix: prefix})
+	return err
+}
+
+// Clear removes all entries from both tiers and from the L1 of peers.
+func (c *TieredCache) Clear(ctx context.Context) error {
+	err := c.remote.Clear(ctx)
+	_ = c.local.Clear(ctx)
+	c.broadcast(ctx, Invalidation{Op: InvalidateAll})
+	return err
+}
+
+// GetDefaultTTL returns the default TTL of L2.
+func (c *TieredCache) GetDefaultTTL() time.Duration {
+	return c.remote.GetDefaultTTL()
+}
+
+// Close stops L1. L2 and the invalidation route are owned by the caller and left open.
+func (c *TieredCache) Close() {
+	c.local.Close()
+}
@@ -0,0 +1,148 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quantumwake/alethic-ism-core-go/pkg/cache"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/memory"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+	"github.com/stretchr/testify/require"
+)
+
+// newTieredNode returns a TieredCache over shared, subscribed to the invalidations of its peers.
+func newTieredNode(t *testing.T, shared cache.Cache) *cache.TieredCache {
+	config := &nats.NatConfig{Selector: "cache/invalidation", Subject: "cache.invalidation", URL: nats.MemoryURLScheme + t.Name()}
+
+	tiered := cache.NewTieredCache(shared, nil, time.Minute)
+	t.Cleanup(tiered.Close)
+
+	route := memory.NewRoute(config, tiered.HandleInvalidation)
+	tiered.SetInvalidationRoute(route)
+	require.NoError(t, route.Subscribe(t.Context()))
+	return tiered
+}
+
+func TestTieredCache_InvalidatesPeers(t *testing.T) {
+	ctx := t.Context()
+
+	shared := cache.NewLocalCache(nil) // stands in for the shared L2
+	defer shared.Close()
+	var _ cache.Cache = (*cache.TieredCache)(nil)
+
+	writer, reader := newTieredNode(t, shared), newTieredNode(t, shared)
+
+	writer.Set(ctx, "FindRouteByID:1", "v1", time.Minute)
+	value, found := reader.Get(ctx, "FindRouteByID:1")
+	require.True(t, found)
+	require.Equal(t, "v1", value)
+
+	// The reader now serves the key from L1, until the writer changes it.
+	shared.Set(ctx, "FindRouteByID:1", "changed behind the tiers", time.Minute)
+	value, _ = reader.Get(ctx, "FindRouteByID:1")
+	require.Equal(t, "v1", value, "expected the L1 value")
+
+	writer.Set(ctx, "FindRouteByID:1", "v2", time.Minute)
+	require.Eventually(t, func() bool {
+		value, _ := reader.Get(ctx, "FindRouteByID:1")
+		return value == "v2"
+	}, 2*time.Second, 10*time.Millisecond, "expected the update to evict the reader L1 entry")
+
+	writer.Delete(ctx, "FindRouteByID:1")
+	require.Eventually(t, func() bool {
+		_, found := reader.Get(ctx, "FindRouteByID:1")
+		return !found
+	}, 2*time.Second, 10*time.Millisecond, "expected the delete to reach the reader")
+
+	for _, key := range []string{"FindUserByID:1", "FindUserByID:2", "FindProject:1"} {
+		writer.Set(ctx, key, key, time.Minute)
+		_, found := reader.Get(ctx, key)
+		require.True(t, found)
+	}
+	// Deleted from L2 by the writer, the entries are only found in the reader L1 until evicted.
+	require.NoError(t, writer.DeleteByPrefix(ctx, "FindUserByID:"))
+	require.Eventually(t, func() bool {
+		_, found1 := reader.Get(ctx, "FindUserByID:1")
+		_, found2 := reader.Get(ctx, "FindUserByID:2")
+		return !found1 && !found2
+	}, 2*time.Second, 10*time.Millisecond, "expected the prefix delete to reach the reader")
+	_, found = reader.Get(ctx, "FindProject:1")
+	require.True(t, found)
+
+	require.NoError(t, writer.Clear(ctx))
+	require.Eventually(t, func() bool {
+		_, found := reader.Get(ctx, "FindProject:1")
+		return !found
+	}, 2*time.Second, 10*time.Millisecond, "expected the clear to reach the reader")
+}
+
+func TestTieredCache_GetCreateOrUpdateFillsL1(t *testing.T) {
+	ctx := t.Context()
+
+	shared := cache.NewLocalCache(nil)
+	defer shared.Close()
+	tiered := cache.NewTieredCache(shared, nil, 50*time.Millisecond)
+	defer tiered.Close()
+
+	fetches := 0
+	fetch := func(exists bool, value any) (any, error) {
+		fetches++
+		return "fetched", nil
+	}
+	for range 3 {
+		value, err := tiered.GetCreateOrUpdate(ctx, "key", fetch, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, "fetched", value)
+	}
+	require.Equal(t, 1, fetches)
+
+	shared.Set(ctx, "key", "changed behind the tiers", time.Minute)
+	value, _ := tiered.Get(ctx, "key")
+	require.Equal(t, "fetched", value, "expected the L1 value")
+	time.Sleep(100 * time.Millisecond)
+	value, _ = tiered.Get(ctx, "key")
+	require.Equal(t, "changed behind the tiers", value, "expected L1 entries to expire after the local TTL")
+}
+
+func TestCachedBackend_InvalidatesAcrossNodes(t *testing.T) {
+	ctx := t.Context()
+
+	shared := cache.NewLocalCache(nil) // stands in for the shared L2
+	defer shared.Close()
+
+	// node a invalidates entries only node b built and cached
+	a := cache.NewCachedBackend(struct{}{}, newTieredNode(t, shared), time.Minute)
+	b := cache.NewCachedBackend(struct{}{}, newTieredNode(t, shared), time.Minute)
+
+	version := "v1"
+	call := func(method string, args ...any) string {
+		value, err := cache.CallCached(b, ctx, method, args, func() (string, error) { return version, nil })
+		require.NoError(t, err)
+		return value
+	}
+	for _, args := range [][]any{{"state-1", "flag1"}, {"state-1", "flag2"}, {"state-2", "flag1"}} {
+		require.Equal(t, "v1", call("FindStateFull", args...))
+	}
+	require.Equal(t, "v1", call("FindUser", "user-1"))
+	require.Equal(t, "v1", call("FindUser", "user-2"))
+
+	version = "v2"
+	require.NoError(t, a.InvalidateMethodPrefix(ctx, "FindStateFull", "state-1"))
+	require.NoError(t, a.InvalidateMethod(ctx, "FindUser", "user-1"))
+
+	require.Eventually(t, func() bool {
+		return call("FindStateFull", "state-1", "flag1") == "v2" &&
+			call("FindStateFull", "state-1", "flag2") == "v2" &&
+			call("FindUser", "user-1") == "v2"
+	}, 2*time.Second, 10*time.Millisecond, "expected the invalidations to reach both tiers of node b")
+	require.Equal(t, "v1", call("FindStateFull", "state-2", "flag1"), "other first arguments are kept")
+	require.Equal(t, "v1", call("FindUser", "user-2"), "other arguments are kept")
+
+	// without arguments, every entry of the method is invalidated
+	version = "v3"
+	require.NoError(t, a.InvalidateMethodPrefix(ctx, "FindStateFull"))
+	require.Eventually(t, func() bool {
+		return call("FindStateFull", "state-2", "flag1") == "v3"
+	}, 2*time.Second, 10*time.Millisecond, "expected the method invalidation to reach node b")
+	require.Equal(t, "v1", call("FindUser", "user-2"))
+}
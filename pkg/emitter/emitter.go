@@ -5,46 +5,109 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/quantumwake/alethic-ism-core-go/pkg/data/models"
 	"github.com/quantumwake/alethic-ism-core-go/pkg/repository/processor"
 	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
 )
 
+// Default retry policy of idempotent state sync publishes.
+const (
+	DefaultPublishAttempts  = 3
+	DefaultPublishRetryWait = 500 * time.Millisecond
+)
+
 // Emitter publishes data to message routes.
 type Emitter struct {
-	stateSync   routing.Route
-	stateRouter routing.Route
-	monitor     routing.Route
+	stateSync   *routing.TypedRoute[models.RouteMessage]
+	stateRouter *routing.TypedRoute[models.RouteMessage]
+	monitor     *routing.TypedRoute[models.MonitorMessage]
+	processorID string
+
+	publishAttempts  int
+	publishRetryWait time.Duration
+	contentMsgIDs    bool
+}
+
+// Option defines a function type for configuring an Emitter.
+type Option func(*Emitter)
+
+// WithProcessorID stamps the processor ID header on every message published by the Emitter.
+func WithProcessorID(processorID string) Option {
+	return func(e *Emitter) {
+		e.processorID = processorID
+	}
+}
+
+// WithPublishRetry sets how often a state sync batch is attempted until JetStream acknowledges it.
+func WithPublishRetry(attempts int, wait time.Duration) Option {
+	return func(e *Emitter) {
+		e.publishAttempts = attempts
+		e.publishRetryWait = wait
+	}
+}
+
+// WithContentDeduplication derives the message ID of state sync batches from their content instead
+// of each publish, so identical batches published within the stream duplicate window are stored
+// once even across separate Publish calls. Only use it for producers that never legitimately
+// publish the same batch twice: the repeated batch is silently dropped by JetStream.
+func WithContentDeduplication() Option {
+	return func(e *Emitter) {
+		e.contentMsgIDs = true
+	}
 }
 
 // New creates an Emitter with the given routes.
-func New(stateSync, stateRouter, monitor routing.Route) *Emitter {
-	return &Emitter{
-		stateSync:   stateSync,
-		stateRouter: stateRouter,
-		monitor:     monitor,
+func New(stateSync, stateRouter, monitor routing.Route, opts ...Option) *Emitter {
+	emitter := &Emitter{
+		stateSync:        routing.NewTypedRoute[models.RouteMessage](stateSync, nil),
+		stateRouter:      routing.NewTypedRoute[models.RouteMessage](stateRouter, nil),
+		monitor:          routing.NewTypedRoute[models.MonitorMessage](monitor, nil),
+		publishAttempts:  DefaultPublishAttempts,
+		publishRetryWait: DefaultPublishRetryWait,
+	}
+	for _, opt := range opts {
+		opt(emitter)
 	}
+	return emitter
 }
 
-// Publish sends a single batch of data as a RouteMessage to state sync.
-func (e *Emitter) Publish(ctx context.Context, routeID string, data []models.Data) error {
-	msg := models.RouteMessage{
-		Type:       models.QueryStateRoute,
-		RouteID:    routeID,
-		QueryState: data,
+// headers returns the publish options stamping the route and processor ID headers.
+func (e *Emitter) headers(routeID string) []routing.PublishOption {
+	opts := []routing.PublishOption{routing.WithHeader(routing.HeaderRouteID, routeID)}
+	if e.processorID != "" {
+		opts = append(opts, routing.WithHeader(routing.HeaderProcessorID, e.processorID))
 	}
+	return opts
+}
 
-	if err := e.stateSync.Publish(ctx, msg); err != nil {
+// Publish sends a single batch of data as a RouteMessage to state sync. The batch is published
+// idempotently: it gets a message ID that every retry of the publish reuses, so a batch whose
+// acknowledgement was lost is not stored twice. Publishing the same data again is a new batch,
+// unless the Emitter was created WithContentDeduplication.
+func (e *Emitter) Publish(ctx context.Context, routeID string, data []models.Data) error {
+	return e.publish(ctx, routeID, data, uuid.NewString())
+}
+
+// publish sends a batch to state sync with msgID as the message ID of every attempt.
+func (e *Emitter) publish(ctx context.Context, routeID string, data []models.Data, msgID string) error {
+	if err := e.stateSync.Publish(ctx, routeMessage(routeID, data), e.stateSyncOptions(routeID, msgID)...); err != nil {
 		return fmt.Errorf("publish to state sync: %w", err)
 	}
-	if err := e.stateSync.Flush(); err != nil {
+	if err := e.stateSync.Route().Flush(); err != nil {
 		return fmt.Errorf("flush state sync: %w", err)
 	}
 	return nil
 }
 
-// PublishBatch splits data into batches and publishes each one.
+// PublishBatch splits data into batches and publishes each one. Batches exceeding the NATS max
+// payload need claim checking enabled on the state sync route (see NatConfig.ClaimCheckThreshold).
+//
+// If the state sync route supports async publishing, batches are pipelined without waiting for
+// each acknowledgement, bounded by the route's max pending publishes. Batches that fail to be
+// acknowledged are republished synchronously with the same message ID, which prevents duplicates.
 func (e *Emitter) PublishBatch(ctx context.Context, routeID string, data []models.Data, batchSize int) error {
 	if batchSize <= 0 {
 		batchSize = 100
@@ -53,18 +116,70 @@ func (e *Emitter) PublishBatch(ctx context.Context, routeID string, data []model
 	totalBatches := (len(data) + batchSize - 1) / batchSize
 	log.Printf("publishing %d records in %d batches to route %s", len(data), totalBatches, routeID)
 
+	if _, ok := e.stateSync.Route().(routing.AsyncPublisher); !ok {
+		for i := 0; i < len(data); i += batchSize {
+			if err := e.Publish(ctx, routeID, data[i:min(i+batchSize, len(data))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	type pendingBatch struct {
+		data   []models.Data
+		msgID  string
+		future *routing.PublishFuture
+	}
+
+	pending := make([]pendingBatch, 0, totalBatches)
 	for i := 0; i < len(data); i += batchSize {
-		end := i + batchSize
-		if end > len(data) {
-			end = len(data)
+		batch := pendingBatch{data: data[i:min(i+batchSize, len(data))], msgID: uuid.NewString()}
+		future, err := e.stateSync.PublishAsync(ctx, routeMessage(routeID, batch.data), e.stateSyncOptions(routeID, batch.msgID)...)
+		if err != nil {
+			return fmt.Errorf("publish to state sync: %w", err)
 		}
-		if err := e.Publish(ctx, routeID, data[i:end]); err != nil {
-			return err
+		batch.future = future
+		pending = append(pending, batch)
+	}
+
+	for _, p := range pending {
+		if err := p.future.Wait(ctx); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("publish to state sync: %w", err)
+			}
+			log.Printf("async publish of batch to route %s failed, republishing: %v", routeID, err)
+			if err := e.publish(ctx, routeID, p.data, p.msgID); err != nil {
+				return err
+			}
 		}
 	}
+
+	if err := e.stateSync.Route().Flush(); err != nil {
+		return fmt.Errorf("flush state sync: %w", err)
+	}
 	return nil
 }
 
+// stateSyncOptions returns the publish options of state sync batches: the route and processor
+// ID headers, and retries with msgID as message ID, or with a content-derived message ID
+// if the Emitter deduplicates by content.
+func (e *Emitter) stateSyncOptions(routeID, msgID string) []routing.PublishOption {
+	opts := append(e.headers(routeID), routing.WithRetry(e.publishAttempts, e.publishRetryWait))
+	if e.contentMsgIDs {
+		return append(opts, routing.WithContentMsgID())
+	}
+	return append(opts, routing.WithMsgID(msgID))
+}
+
+// routeMessage wraps a batch of data in a RouteMessage for state sync.
+func routeMessage(routeID string, data []models.Data) models.RouteMessage {
+	return models.RouteMessage{
+		Type:       models.QueryStateRoute,
+		RouteID:    routeID,
+		QueryState: data,
+	}
+}
+
 // ReportStatus sends a status update to the monitor route.
 func (e *Emitter) ReportStatus(ctx context.Context, routeID string, status processor.Status, exception string) {
 	msg := models.MonitorMessage{
@@ -74,10 +189,10 @@ func (e *Emitter) ReportStatus(ctx context.Context, routeID string, status proce
 		Exception: exception,
 	}
 
-	if err := e.monitor.Publish(ctx, msg); err != nil {
+	if err := e.monitor.Publish(ctx, msg, e.headers(routeID)...); err != nil {
 		log.Printf("error publishing monitor message for route %s: %v", routeID, err)
 	}
-	if err := e.monitor.Flush(); err != nil {
+	if err := e.monitor.Route().Flush(); err != nil {
 		log.Printf("error flushing monitor route: %v", err)
 	}
 }
@@ -0,0 +1,141 @@
+package emitter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/data/models"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/repository/processor"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/memory"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRoute(t *testing.T, subject string, ch chan routing.MessageEnvelop) routing.Route {
+	config := &nats.NatConfig{Selector: subject, Subject: subject, URL: nats.MemoryURLScheme + t.Name()}
+	route := memory.NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, route.Subscribe(t.Context()))
+	return route
+}
+
+func receive(t *testing.T, ch <-chan routing.MessageEnvelop) routing.MessageEnvelop {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for message")
+		return nil
+	}
+}
+
+func TestEmitter_StampsHeaders(t *testing.T) {
+	ctx := t.Context()
+	syncCh := make(chan routing.MessageEnvelop, 1)
+	monitorCh := make(chan routing.MessageEnvelop, 1)
+
+	e := New(
+		newTestRoute(t, "test.state.sync", syncCh),
+		newTestRoute(t, "test.state.router", make(chan routing.MessageEnvelop, 1)),
+		newTestRoute(t, "test.monitor", monitorCh),
+		WithProcessorID("processor-1"),
+	)
+
+	require.NoError(t, e.Publish(ctx, "route-1", []models.Data{{"key": "value"}}))
+	msg := receive(t, syncCh)
+	require.Equal(t, "route-1", msg.Headers().Get(routing.HeaderRouteID))
+	require.Equal(t, "processor-1", msg.Headers().Get(routing.HeaderProcessorID))
+
+	e.ReportStatus(ctx, "route-1", processor.Completed, "")
+	msg = receive(t, monitorCh)
+	require.Equal(t, "route-1", msg.Headers().Get(routing.HeaderRouteID))
+	require.Equal(t, "processor-1", msg.Headers().Get(routing.HeaderProcessorID))
+}
+
+func TestEmitter_PublishDeduplication(t *testing.T) {
+	ctx := t.Context()
+
+	for _, contentDedup := range []bool{false, true} {
+		config := &nats.NatConfig{
+			Selector: "test/state/sync",
+			Name:     ptr.String("test_state_sync"),
+			Queue:    ptr.String("test_state_sync_consumer"),
+			Subject:  "test.state.sync",
+			URL:      nats.MemoryURLScheme + t.Name() + fmt.Sprint(contentDedup),
+		}
+		syncCh := make(chan routing.MessageEnvelop, 2)
+		stateSync := memory.NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { syncCh <- msg })
+		require.NoError(t, stateSync.Subscribe(ctx))
+
+		var opts []Option
+		if contentDedup {
+			opts = append(opts, WithContentDeduplication())
+		}
+		e := New(stateSync,
+			newTestRoute(t, "test.state.router", make(chan routing.MessageEnvelop, 1)),
+			newTestRoute(t, "test.monitor", make(chan routing.MessageEnvelop, 1)),
+			opts...,
+		)
+
+		// the same batch emitted twice, e.g. a state row emitted again
+		batch := []models.Data{{"key": "value"}}
+		require.NoError(t, e.Publish(ctx, "route-1", batch))
+		require.NoError(t, e.Publish(ctx, "route-1", batch))
+
+		first := receive(t, syncCh)
+		require.NotEmpty(t, first.Headers().Get(routing.HeaderMsgID))
+		require.NoError(t, first.Ack(ctx))
+
+		if contentDedup {
+			select {
+			case <-syncCh:
+				t.Fatal("duplicate batch delivered with content deduplication")
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+		second := receive(t, syncCh)
+		require.NotEqual(t, first.Headers().Get(routing.HeaderMsgID), second.Headers().Get(routing.HeaderMsgID),
+			"separate publishes of the same data must not be deduplicated")
+		require.NoError(t, second.Ack(ctx))
+	}
+}
+
+func TestEmitter_PublishBatchPipelines(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector: "test/state/sync",
+		Name:     ptr.String("test_state_sync"),
+		Queue:    ptr.String("test_state_sync_consumer"),
+		Subject:  "test.state.sync",
+		URL:      nats.MemoryURLScheme + t.Name(),
+	}
+	syncCh := make(chan routing.MessageEnvelop, 10)
+	stateSync := memory.NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { syncCh <- msg })
+	require.NoError(t, stateSync.Subscribe(ctx))
+
+	e := New(stateSync,
+		newTestRoute(t, "test.state.router", make(chan routing.MessageEnvelop, 1)),
+		newTestRoute(t, "test.monitor", make(chan routing.MessageEnvelop, 1)),
+	)
+
+	data := make([]models.Data, 25)
+	for i := range data {
+		data[i] = models.Data{"index": i}
+	}
+	require.NoError(t, e.PublishBatch(ctx, "route-1", data, 10))
+
+	var records int
+	for i := 0; i < 3; i++ {
+		msg := receive(t, syncCh)
+		var batch models.RouteMessage
+		require.NoError(t, msg.Decode(&batch))
+		records += len(batch.QueryState)
+		require.NoError(t, msg.Ack(ctx))
+	}
+	require.Equal(t, 25, records)
+}
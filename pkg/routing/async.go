@@ -0,0 +1,73 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAsyncNotSupported is returned when publishing asynchronously on a route that is not an AsyncPublisher.
+var ErrAsyncNotSupported = errors.New("route does not support async publishing")
+
+// AsyncPublisher is implemented by routes that can publish without waiting for each
+// acknowledgement. The number of unacknowledged publishes is bounded: PublishAsync blocks
+// until a slot frees up, providing back-pressure to fast producers.
+type AsyncPublisher interface {
+	// PublishAsync publishes msg to the route subject and returns a future completed once
+	// the publish is acknowledged or failed.
+	PublishAsync(ctx context.Context, msg any, opts ...PublishOption) (*PublishFuture, error)
+
+	// AsyncErrors returns a channel receiving an *AsyncPublishError for every failed
+	// asynchronous publish. Errors are dropped when the channel is full.
+	AsyncErrors() <-chan error
+}
+
+// AsyncPublishError reports an asynchronous publish that was not acknowledged.
+type AsyncPublishError struct {
+	Subject string
+	MsgID   string
+	Err     error
+}
+
+func (e *AsyncPublishError) Error() string {
+	return fmt.Sprintf("async publish to %s failed (msg id: %q): %v", e.Subject, e.MsgID, e.Err)
+}
+
+func (e *AsyncPublishError) Unwrap() error { return e.Err }
+
+// PublishFuture completes when an asynchronous publish is acknowledged or failed.
+type PublishFuture struct {
+	done chan struct{}
+	err  error
+}
+
+// NewPublishFuture returns a pending future.
+func NewPublishFuture() *PublishFuture {
+	return &PublishFuture{done: make(chan struct{})}
+}
+
+// Complete resolves the future with the publish result. It must be called exactly once.
+func (f *PublishFuture) Complete(err error) {
+	f.err = err
+	close(f.done)
+}
+
+// Done returns a channel closed when the publish completed.
+func (f *PublishFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the publish error; it is only valid once Done is closed.
+func (f *PublishFuture) Err() error {
+	return f.err
+}
+
+// Wait blocks until the publish completed and returns its error, or until ctx is done.
+func (f *PublishFuture) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,35 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ToBytes converts a message to a byte slice.
+// []byte is used as is, strings are converted directly and any other type is marshaled to JSON.
+func ToBytes(msg any) ([]byte, error) {
+	var data []byte
+	var err error
+
+	switch v := msg.(type) {
+	case []byte:
+		// If it's already a byte array, use it directly
+		data = v
+	case string:
+		// if a string then turn it into bytes
+		return []byte(v), nil
+	case map[string]any:
+		// If it's a map, marshal it to JSON
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal map to JSON: %w", err)
+		}
+	default:
+		// For any other type, try to marshal it to JSON
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal message to JSON: %w", err)
+		}
+	}
+	return data, nil
+}
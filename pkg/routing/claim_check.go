@@ -0,0 +1,92 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// DefaultClaimCheckPrefix is the object key prefix of claim checked payloads.
+const DefaultClaimCheckPrefix = "claim-check/"
+
+// ErrClaimCheckStoreNotSet is returned when a payload must be stored or fetched by reference
+// but no store was registered with SetClaimCheckStore.
+var ErrClaimCheckStoreNotSet = errors.New("claim check store not set")
+
+// BlobStore stores payloads by key. *s3.Client satisfies it, as does the in-memory
+// stand-in memory.BlobStore.
+type BlobStore interface {
+	UploadBytes(ctx context.Context, key string, data []byte) error
+	DownloadBytes(ctx context.Context, key string) ([]byte, error)
+}
+
+var (
+	claimCheckMu    sync.RWMutex
+	claimCheckStore BlobStore
+)
+
+// SetClaimCheckStore registers the store used by all routes to upload and fetch claim checked payloads.
+func SetClaimCheckStore(store BlobStore) {
+	claimCheckMu.Lock()
+	defer claimCheckMu.Unlock()
+	claimCheckStore = store
+}
+
+// ClaimCheckStore returns the registered claim check store, or nil.
+func ClaimCheckStore() BlobStore {
+	claimCheckMu.RLock()
+	defer claimCheckMu.RUnlock()
+	return claimCheckStore
+}
+
+// ClaimCheck uploads payloads larger than Threshold bytes to the claim check store and
+// publishes only a reference to them, carried in the Claim-Check header. Objects are not
+// deleted once consumed; expire them with a bucket lifecycle rule on Prefix.
+type ClaimCheck struct {
+	Threshold int
+	Prefix    string
+}
+
+// Check returns data unchanged if it is within the threshold. Otherwise it uploads data,
+// stamps header with the object key and returns the key as the message body.
+func (c *ClaimCheck) Check(ctx context.Context, data []byte, header Header) ([]byte, error) {
+	if len(data) <= c.Threshold {
+		return data, nil
+	}
+
+	store := ClaimCheckStore()
+	if store == nil {
+		return nil, ErrClaimCheckStoreNotSet
+	}
+
+	key := c.Prefix + uuid.NewString()
+	if err := store.UploadBytes(ctx, key, data); err != nil {
+		return nil, fmt.Errorf("failed to upload claim checked payload %s: %w", key, err)
+	}
+
+	header.Set(HeaderClaimCheck, key)
+	return []byte(key), nil
+}
+
+// ResolveClaimCheck returns the payload referenced by the Claim-Check header, or data
+// itself if the message carries its payload inline.
+func ResolveClaimCheck(ctx context.Context, header Header, data []byte) ([]byte, error) {
+	key := header.Get(HeaderClaimCheck)
+	if key == "" {
+		return data, nil
+	}
+
+	store := ClaimCheckStore()
+	if store == nil {
+		return nil, ErrClaimCheckStoreNotSet
+	}
+
+	payload, err := store.DownloadBytes(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download claim checked payload %s: %w", key, err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,123 @@
+package routing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes and decodes message payloads.
+type Codec interface {
+	// ContentType identifies the encoding, it is published in the Content-Type header.
+	ContentType() string
+
+	// Marshal encodes v into bytes.
+	Marshal(v any) ([]byte, error)
+
+	// Unmarshal decodes data into v, which must be a pointer.
+	Unmarshal(data []byte, v any) error
+}
+
+// Content types of the built-in codecs.
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeMsgPack = "application/msgpack"
+	ContentTypeCBOR    = "application/cbor"
+)
+
+// Built-in codecs. JSON is the default encoding of all routes.
+var (
+	JSON    Codec = JSONCodec{}
+	MsgPack Codec = MsgPackCodec{}
+	CBOR    Codec = CBORCodec{}
+)
+
+// JSONCodec encodes payloads as JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string { return ContentTypeJSON }
+
+func (JSONCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// MsgPackCodec encodes payloads as MessagePack. Struct fields use their json tags,
+// so models encode with the same field names as JSON.
+type MsgPackCodec struct{}
+
+func (MsgPackCodec) ContentType() string { return ContentTypeMsgPack }
+
+func (MsgPackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgPackCodec) Unmarshal(data []byte, v any) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
+
+// CBORCodec encodes payloads as CBOR (RFC 8949). Struct fields use their json tags.
+type CBORCodec struct{}
+
+func (CBORCodec) ContentType() string { return ContentTypeCBOR }
+
+func (CBORCodec) Marshal(v any) ([]byte, error) { return cbor.Marshal(v) }
+
+func (CBORCodec) Unmarshal(data []byte, v any) error { return cborDecMode.Unmarshal(data, v) }
+
+// cborDecMode decodes maps as map[string]any, matching JSON, rather than map[any]any.
+var cborDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+
+var (
+	codecsMu            sync.RWMutex
+	codecsByName        = map[string]Codec{"json": JSON, "msgpack": MsgPack, "cbor": CBOR}
+	codecsByContentType = map[string]Codec{ContentTypeJSON: JSON, ContentTypeMsgPack: MsgPack, ContentTypeCBOR: CBOR}
+)
+
+// RegisterCodec makes codec available by name (as used by the route codec setting) and by content type.
+func RegisterCodec(name string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecsByName[name] = codec
+	codecsByContentType[codec.ContentType()] = codec
+}
+
+// CodecByName returns the codec registered under name.
+func CodecByName(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, found := codecsByName[name]
+	if !found {
+		return nil, fmt.Errorf("unknown codec: %s", name)
+	}
+	return codec, nil
+}
+
+// CodecForContentType returns the codec registered for contentType.
+func CodecForContentType(contentType string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, found := codecsByContentType[contentType]
+	return codec, found
+}
+
+// CodecForHeader returns the codec named by the Content-Type header, or fallback if the
+// header is absent or unknown.
+func CodecForHeader(header Header, fallback Codec) Codec {
+	if codec, found := CodecForContentType(header.Get(HeaderContentType)); found {
+		return codec
+	}
+	return fallback
+}
@@ -0,0 +1,63 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/quantumwake/alethic-ism-core-go/pkg/data/models"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	message := models.RouteMessage{RouteID: "route-1", QueryState: []models.Data{{"name": "alice", "age": "33"}}}
+
+	for _, codec := range []routing.Codec{routing.JSON, routing.MsgPack, routing.CBOR} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			data, err := codec.Marshal(message)
+			require.NoError(t, err)
+
+			var decoded models.RouteMessage
+			require.NoError(t, codec.Unmarshal(data, &decoded))
+			require.Equal(t, message, decoded)
+
+			// maps decode with string keys regardless of codec
+			var mapping map[string]any
+			require.NoError(t, codec.Unmarshal(data, &mapping))
+			require.Equal(t, "route-1", mapping["route_id"])
+		})
+	}
+}
+
+func TestEncoding_EncodeAndDecode(t *testing.T) {
+	for _, spec := range []string{"json", "msgpack+gzip", "cbor+zstd"} {
+		t.Run(spec, func(t *testing.T) {
+			encoding, err := routing.ParseEncoding(spec)
+			require.NoError(t, err)
+
+			header := routing.Header{}
+			data, err := encoding.Encode(map[string]any{"name": "alice"}, header)
+			require.NoError(t, err)
+			require.Equal(t, encoding.Codec.ContentType(), header.Get(routing.HeaderContentType))
+
+			raw, err := routing.DecompressPayload(header, data)
+			require.NoError(t, err)
+
+			var decoded map[string]any
+			require.NoError(t, routing.UnmarshalPayload(header, raw, &decoded))
+			require.Equal(t, "alice", decoded["name"])
+		})
+	}
+
+	_, err := routing.ParseEncoding("json+brotli")
+	require.Error(t, err)
+	_, err = routing.ParseEncoding("avro")
+	require.Error(t, err)
+}
+
+func TestEncoding_RawPayloadsPassThrough(t *testing.T) {
+	header := routing.Header{}
+	data, err := routing.DefaultEncoding.Encode("plain text", header)
+	require.NoError(t, err)
+	require.Equal(t, []byte("plain text"), data)
+	require.Empty(t, header)
+}
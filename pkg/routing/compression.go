@@ -0,0 +1,113 @@
+package routing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor compresses message payloads. The encoding name is published in the Content-Encoding header.
+type Compressor interface {
+	// Encoding identifies the compression, e.g. "gzip" or "zstd".
+	Encoding() string
+
+	// Compress returns the compressed form of data.
+	Compress(data []byte) ([]byte, error)
+
+	// Decompress returns the original form of compressed data.
+	Decompress(data []byte) ([]byte, error)
+}
+
+// Built-in compressors.
+var (
+	Gzip Compressor = GzipCompressor{}
+	Zstd Compressor = &ZstdCompressor{}
+)
+
+// GzipCompressor compresses payloads with gzip.
+type GzipCompressor struct{}
+
+func (GzipCompressor) Encoding() string { return "gzip" }
+
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// ZstdCompressor compresses payloads with zstd. The encoder and decoder are created
+// on first use and shared, both are safe for concurrent use.
+type ZstdCompressor struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func (z *ZstdCompressor) init() error {
+	z.once.Do(func() {
+		if z.encoder, z.err = zstd.NewWriter(nil); z.err != nil {
+			return
+		}
+		z.decoder, z.err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+	return z.err
+}
+
+func (z *ZstdCompressor) Encoding() string { return "zstd" }
+
+func (z *ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.encoder.EncodeAll(data, nil), nil
+}
+
+func (z *ZstdCompressor) Decompress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.decoder.DecodeAll(data, nil)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{"gzip": Gzip, "zstd": Zstd}
+)
+
+// RegisterCompressor makes compressor available by its encoding name.
+func RegisterCompressor(compressor Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[compressor.Encoding()] = compressor
+}
+
+// CompressorByEncoding returns the compressor registered for encoding.
+func CompressorByEncoding(encoding string) (Compressor, error) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	compressor, found := compressors[encoding]
+	if !found {
+		return nil, fmt.Errorf("unknown content encoding: %s", encoding)
+	}
+	return compressor, nil
+}
@@ -0,0 +1,92 @@
+package routing
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Encoding pairs a payload codec with optional compression, as configured per route
+// with a spec such as "json", "msgpack+zstd" or "cbor+gzip".
+type Encoding struct {
+	Codec      Codec
+	Compressor Compressor // nil for uncompressed payloads
+}
+
+// DefaultEncoding is uncompressed JSON.
+var DefaultEncoding = &Encoding{Codec: JSON}
+
+// ParseEncoding parses a "<codec>[+<compression>]" spec. An empty spec returns DefaultEncoding.
+func ParseEncoding(spec string) (*Encoding, error) {
+	if spec == "" {
+		return DefaultEncoding, nil
+	}
+
+	name, compression, compressed := strings.Cut(spec, "+")
+	codec, err := CodecByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := &Encoding{Codec: codec}
+	if compressed {
+		if encoding.Compressor, err = CompressorByEncoding(compression); err != nil {
+			return nil, err
+		}
+	}
+	return encoding, nil
+}
+
+// Encode serializes msg and stamps header with its Content-Type and Content-Encoding.
+// []byte and string payloads are sent as is (only compressed); any other value is
+// marshaled with the codec unless header already names a content type.
+func (e *Encoding) Encode(msg any, header Header) ([]byte, error) {
+	var data []byte
+	var err error
+
+	switch v := msg.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		codec := e.Codec
+		if contentType := header.Get(HeaderContentType); contentType != "" {
+			if codec, _ = CodecForContentType(contentType); codec == nil {
+				return nil, fmt.Errorf("unknown content type: %s", contentType)
+			}
+		}
+		if data, err = codec.Marshal(v); err != nil {
+			return nil, fmt.Errorf("failed to marshal message to %s: %w", codec.ContentType(), err)
+		}
+		header.Set(HeaderContentType, codec.ContentType())
+	}
+
+	if e.Compressor != nil && header.Get(HeaderContentEncoding) == "" {
+		if data, err = e.Compressor.Compress(data); err != nil {
+			return nil, fmt.Errorf("failed to compress message with %s: %w", e.Compressor.Encoding(), err)
+		}
+		header.Set(HeaderContentEncoding, e.Compressor.Encoding())
+	}
+
+	return data, nil
+}
+
+// DecompressPayload reverses the compression named by the Content-Encoding header, if any.
+func DecompressPayload(header Header, data []byte) ([]byte, error) {
+	encoding := header.Get(HeaderContentEncoding)
+	if encoding == "" || encoding == "identity" {
+		return data, nil
+	}
+
+	compressor, err := CompressorByEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return compressor.Decompress(data)
+}
+
+// UnmarshalPayload decodes an uncompressed payload into v with the codec named by the
+// Content-Type header, defaulting to JSON.
+func UnmarshalPayload(header Header, data []byte, v any) error {
+	return CodecForHeader(header, JSON).Unmarshal(data, v)
+}
@@ -0,0 +1,70 @@
+// Package factory creates routing.Route implementations from the routing configuration.
+//
+// Routes whose URL uses the memory:// scheme are served by the in-process broker
+// (package routing/memory); all other routes connect to a NATS server. This lets
+// services run fully offline by pointing their routing file at memory:// URLs.
+package factory
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/memory"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+)
+
+// NewRoute returns the route implementation selected by the config URL.
+func NewRoute(config *nats.NatConfig, callback func(ctx context.Context, msg routing.MessageEnvelop)) routing.Route {
+	if config.InMemory() {
+		return memory.NewRoute(config, callback)
+	}
+	return nats.NewRoute(config, callback)
+}
+
+// NewResponderRoute returns the route implementation selected by the config URL, serving
+// requests with responder once subscribed in "request-reply" mode.
+func NewResponderRoute(config *nats.NatConfig, responder routing.Responder) routing.Route {
+	if config.InMemory() {
+		return memory.NewResponderRoute(config, responder)
+	}
+	return nats.NewResponderRoute(config, responder)
+}
+
+// NewRouteUsingSelector loads the routing config from the environment and connects the route for selector.
+func NewRouteUsingSelector(ctx context.Context, selector string) (routing.Route, error) {
+	return newRouteUsingSelector(ctx, selector, nil)
+}
+
+// NewRouteSubscriberUsingSelector connects the route for selector and subscribes callback to it.
+func NewRouteSubscriberUsingSelector(ctx context.Context, selector string, callback func(ctx context.Context, msg routing.MessageEnvelop)) (routing.Route, error) {
+	route, err := newRouteUsingSelector(ctx, selector, callback)
+	if err != nil {
+		return nil, fmt.Errorf("failed subscribe to selector: %s; err: %w", selector, err)
+	}
+
+	log.Printf("subscribing on selector: %s", selector)
+	if err = route.Subscribe(ctx); err != nil {
+		return nil, fmt.Errorf("unable to subscribe: %v", err)
+	}
+	return route, nil
+}
+
+func newRouteUsingSelector(ctx context.Context, selector string, callback func(ctx context.Context, msg routing.MessageEnvelop)) (routing.Route, error) {
+	config, err := nats.LoadConfigFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config for selector: %s; err: %w", selector, err)
+	}
+
+	routeConfig, err := config.FindRouteBySelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("error finding route selector: %s; err: %w", selector, err)
+	}
+
+	route := NewRoute(routeConfig, callback)
+	if err = route.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("error connecting to route %s: %w", selector, err)
+	}
+	return route, nil
+}
@@ -0,0 +1,259 @@
+// Package handler provides middleware for route callbacks.
+//
+// Wrap turns a typed processing function into a route callback that takes care
+// of the boilerplate every processor repeats: recovering from panics, decoding
+// the payload, acknowledging on success, retrying with exponential backoff
+// (based on the JetStream delivery count) and dead-lettering messages that can
+// never succeed, or terminating them when the route has no dead-letter subject.
+// The returned callback works with both nats.Route and nats.ConcurrentRoute, as
+// well as the in-memory route.
+//
+//	route, err := nats.NewRouteSubscriberUsingSelector(ctx, "processor/usage",
+//		handler.Wrap(func(ctx context.Context, msg routing.MessageEnvelop, usage models.RouteMessage) error {
+//			return process(ctx, usage)
+//		}, handler.WithBackoff(time.Second, time.Minute)))
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"runtime/debug"
+	"time"
+
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+)
+
+// ErrPanic is wrapped by errors produced from a recovered panic in the handler.
+var ErrPanic = errors.New("handler panicked")
+
+// ErrDecode is wrapped by errors produced when the payload cannot be decoded.
+// Decode errors are permanent, a malformed payload will never decode on redelivery.
+var ErrDecode = routing.ErrDecode
+
+// Handler processes a decoded message payload. Returning nil acknowledges the message,
+// returning a Permanent error dead-letters or terminates it, and any other error schedules a redelivery.
+type Handler[T any] func(ctx context.Context, msg routing.MessageEnvelop, payload T) error
+
+// Decoder decodes raw message bytes into v.
+type Decoder func(data []byte, v any) error
+
+// permanentError marks an error as non-retryable.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the message is dead-lettered, or terminated, instead of redelivered.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent returns true if err, or any error it wraps, was marked with Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// errorNaker is implemented by envelopes that record the processing error on NAK,
+// so it can be reported when the message is dead-lettered.
+type errorNaker interface {
+	NakWithError(ctx context.Context, delay time.Duration, cause error) error
+}
+
+// deadLetterer is implemented by envelopes that can republish the message to the dead-letter
+// subject of their route.
+type deadLetterer interface {
+	DeadLetter(ctx context.Context, cause error) error
+}
+
+// Options configures the behaviour of a wrapped handler.
+type Options struct {
+	InitialBackoff time.Duration // delay before the first redelivery
+	MaxBackoff     time.Duration // upper bound of the redelivery delay, 0 leaves it unbounded
+	Multiplier     float64       // growth factor applied per delivery attempt
+	MaxAttempts    int           // give up after this many deliveries, 0 leaves the limit to the consumer max_deliver
+	Codec          routing.Codec // codec of messages without a Content-Type header, JSON if nil
+	Decoder        Decoder       // payload decoder, nil decodes with the codec named by the Content-Type header
+}
+
+// Option defines a function type for configuring Options.
+type Option func(*Options)
+
+// WithBackoff sets the initial and maximum redelivery delays.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(o *Options) {
+		o.InitialBackoff = initial
+		o.MaxBackoff = max
+	}
+}
+
+// WithMultiplier sets the exponential growth factor of the redelivery delay.
+func WithMultiplier(multiplier float64) Option {
+	return func(o *Options) {
+		o.Multiplier = multiplier
+	}
+}
+
+// WithMaxAttempts gives up on messages once they have been delivered attempts times.
+func WithMaxAttempts(attempts int) Option {
+	return func(o *Options) {
+		o.MaxAttempts = attempts
+	}
+}
+
+// WithCodec decodes messages without a Content-Type header with codec instead of JSON,
+// typically the codec of the TypedRoute publishing them.
+func WithCodec(codec routing.Codec) Option {
+	return func(o *Options) {
+		o.Codec = codec
+	}
+}
+
+// WithDecoder replaces the default Content-Type based payload decoder.
+func WithDecoder(decoder Decoder) Option {
+	return func(o *Options) {
+		o.Decoder = decoder
+	}
+}
+
+// NewDefaultOptions returns options with a 1s initial backoff doubling up to 1 minute.
+func NewDefaultOptions() *Options {
+	return &Options{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Multiplier:     2,
+	}
+}
+
+// Backoff returns the redelivery delay after the given number of deliveries.
+func (o *Options) Backoff(deliveries uint64) time.Duration {
+	if deliveries < 1 {
+		deliveries = 1
+	}
+
+	// a zero MaxBackoff leaves the delay unbounded, short of overflowing time.Duration
+	limit := time.Duration(math.MaxInt64)
+	if o.MaxBackoff > 0 {
+		limit = o.MaxBackoff
+	}
+
+	delay := float64(o.InitialBackoff)
+	for i := uint64(1); i < deliveries && delay < float64(limit); i++ {
+		delay *= o.Multiplier
+	}
+
+	if delay >= float64(limit) {
+		return limit
+	}
+	return time.Duration(delay)
+}
+
+// Wrap returns a route callback that decodes each message into T and invokes handler,
+// acknowledging, retrying, dead-lettering or terminating the message depending on the outcome.
+func Wrap[T any](handler Handler[T], opts ...Option) func(ctx context.Context, msg routing.MessageEnvelop) {
+	options := NewDefaultOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return func(ctx context.Context, msg routing.MessageEnvelop) {
+		err := invoke(ctx, msg, handler, options)
+		settle(ctx, msg, err, options)
+	}
+}
+
+// invoke decodes the payload and calls handler, converting panics into errors.
+func invoke[T any](ctx context.Context, msg routing.MessageEnvelop, handler Handler[T], options *Options) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic handling message on subject %s: %v\n%s", msg.Subject(), r, debug.Stack())
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+
+	payload, err := decode[T](msg, options)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	return handler(ctx, msg, payload)
+}
+
+// decode decodes msg into T with the options decoder, or with the codec named by the
+// Content-Type header when there is none.
+func decode[T any](msg routing.MessageEnvelop, options *Options) (T, error) {
+	if options.Decoder == nil {
+		return routing.Decode[T](options.Codec, msg)
+	}
+
+	var payload T
+	raw, err := msg.MessageRaw()
+	if err == nil {
+		err = options.Decoder(raw, &payload)
+	}
+	if err != nil {
+		return payload, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return payload, nil
+}
+
+// settle acknowledges, naks or gives up on the message based on the handler result.
+func settle(ctx context.Context, msg routing.MessageEnvelop, err error, options *Options) {
+	deliveries := uint64(1)
+	if meta, metaErr := msg.Metadata(); metaErr == nil {
+		deliveries = meta.NumDelivered
+	}
+
+	switch {
+	case err == nil:
+		if ackErr := msg.Ack(ctx); ackErr != nil {
+			log.Printf("failed to ack message on subject %s: %v", msg.Subject(), ackErr)
+		}
+		return
+
+	case IsPermanent(err), options.MaxAttempts > 0 && deliveries >= uint64(options.MaxAttempts):
+		giveUp(ctx, msg, deliveries, err)
+		return
+	}
+
+	delay := options.Backoff(deliveries)
+	log.Printf("retrying message on subject %s in %v (delivery %d): %v", msg.Subject(), delay, deliveries, err)
+
+	var nakErr error
+	if naker, ok := msg.(errorNaker); ok {
+		nakErr = naker.NakWithError(ctx, delay, err)
+	} else {
+		nakErr = msg.NakWithDelay(ctx, delay)
+	}
+	if nakErr != nil {
+		log.Printf("failed to nak message on subject %s: %v", msg.Subject(), nakErr)
+	}
+}
+
+// giveUp moves a message that will never succeed to the dead-letter subject of its route, or
+// terminates it when the route has none.
+func giveUp(ctx context.Context, msg routing.MessageEnvelop, deliveries uint64, err error) {
+	if dl, ok := msg.(deadLetterer); ok {
+		dlErr := dl.DeadLetter(ctx, err)
+		if dlErr == nil {
+			log.Printf("dead-lettered message on subject %s after %d deliveries: %v", msg.Subject(), deliveries, err)
+			return
+		}
+		if !errors.Is(dlErr, routing.ErrNoDeadLetter) {
+			log.Printf("failed to dead-letter message on subject %s, terminating: %v", msg.Subject(), dlErr)
+		}
+	}
+
+	log.Printf("terminating message on subject %s after %d deliveries: %v", msg.Subject(), deliveries, err)
+	if termErr := msg.Term(ctx); termErr != nil {
+		log.Printf("failed to terminate message on subject %s: %v", msg.Subject(), termErr)
+	}
+}
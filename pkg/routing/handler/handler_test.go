@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/data/models"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/memory"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRoute(t *testing.T, callback func(ctx context.Context, msg routing.MessageEnvelop)) *memory.Route {
+	config := &nats.NatConfig{
+		Selector: "test/handler",
+		Name:     ptr.String("test_handler_stream"),
+		Queue:    ptr.String("test_handler_consumer"),
+		Subject:  "test.handler",
+		URL:      nats.MemoryURLScheme + t.Name(),
+	}
+	route := memory.NewRoute(config, callback)
+	require.NoError(t, route.Subscribe(t.Context()))
+	return route
+}
+
+func TestOptions_Backoff(t *testing.T) {
+	options := NewDefaultOptions()
+	options.InitialBackoff = 100 * time.Millisecond
+	options.MaxBackoff = time.Second
+
+	require.Equal(t, 100*time.Millisecond, options.Backoff(0))
+	require.Equal(t, 100*time.Millisecond, options.Backoff(1))
+	require.Equal(t, 200*time.Millisecond, options.Backoff(2))
+	require.Equal(t, 800*time.Millisecond, options.Backoff(4))
+	require.Equal(t, time.Second, options.Backoff(5))
+	require.Equal(t, time.Second, options.Backoff(1000))
+
+	// without a maximum the delay keeps growing, saturating instead of overflowing
+	options.MaxBackoff = 0
+	require.Equal(t, 1600*time.Millisecond, options.Backoff(5))
+	require.Equal(t, time.Duration(math.MaxInt64), options.Backoff(1000))
+}
+
+func TestWrap_RetriesThenAcks(t *testing.T) {
+	ctx := t.Context()
+
+	var attempts atomic.Int32
+	done := make(chan models.RouteMessage, 1)
+	route := newTestRoute(t, Wrap(func(ctx context.Context, msg routing.MessageEnvelop, payload models.RouteMessage) error {
+		switch attempts.Add(1) {
+		case 1:
+			return errors.New("transient failure")
+		case 2:
+			panic("unexpected state")
+		}
+		done <- payload
+		return nil
+	}, WithBackoff(10*time.Millisecond, 50*time.Millisecond)))
+
+	require.NoError(t, route.Publish(ctx, models.RouteMessage{Type: models.QueryStateRoute, RouteID: "route-1"}))
+
+	select {
+	case payload := <-done:
+		require.Equal(t, "route-1", payload.RouteID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for successful delivery")
+	}
+
+	// acknowledged messages are not redelivered
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, int32(3), attempts.Load())
+}
+
+func TestWrap_TerminatesPermanentFailures(t *testing.T) {
+	ctx := t.Context()
+
+	var attempts atomic.Int32
+	route := newTestRoute(t, Wrap(func(ctx context.Context, msg routing.MessageEnvelop, payload models.RouteMessage) error {
+		attempts.Add(1)
+		if payload.RouteID == "invalid" {
+			return Permanent(errors.New("invalid route"))
+		}
+		return errors.New("always failing")
+	}, WithBackoff(10*time.Millisecond, 10*time.Millisecond), WithMaxAttempts(3)))
+
+	// without a dead-letter subject, malformed payloads are terminated without invoking the handler
+	require.NoError(t, route.Publish(ctx, "not json"))
+	require.NoError(t, route.Publish(ctx, models.RouteMessage{RouteID: "invalid"}))
+	require.NoError(t, route.Publish(ctx, models.RouteMessage{RouteID: "retry"}))
+
+	time.Sleep(500 * time.Millisecond)
+	require.Equal(t, int32(1+3), attempts.Load())
+}
+
+func TestWrap_DeadLettersPermanentFailures(t *testing.T) {
+	ctx := t.Context()
+
+	dead := make(chan routing.MessageEnvelop, 3)
+	dlq := memory.NewRoute(&nats.NatConfig{Selector: "test/handler/dead", Subject: "test.handler.dead", URL: nats.MemoryURLScheme + t.Name()},
+		func(ctx context.Context, msg routing.MessageEnvelop) { dead <- msg })
+	require.NoError(t, dlq.Subscribe(ctx))
+
+	config := &nats.NatConfig{
+		Selector:          "test/handler",
+		Name:              ptr.String("test_handler_stream"),
+		Queue:             ptr.String("test_handler_consumer"),
+		Subject:           "test.handler",
+		URL:               nats.MemoryURLScheme + t.Name(),
+		DeadLetterSubject: ptr.String("test.handler.dead"),
+	}
+	route := memory.NewRoute(config, Wrap(func(ctx context.Context, msg routing.MessageEnvelop, payload models.RouteMessage) error {
+		if payload.RouteID == "invalid" {
+			return Permanent(errors.New("invalid route"))
+		}
+		return errors.New("always failing")
+	}, WithBackoff(10*time.Millisecond, 10*time.Millisecond), WithMaxAttempts(2)))
+	require.NoError(t, route.Subscribe(ctx))
+
+	require.NoError(t, route.Publish(ctx, "not json"))
+	require.NoError(t, route.Publish(ctx, models.RouteMessage{RouteID: "invalid"}))
+	require.NoError(t, route.Publish(ctx, models.RouteMessage{RouteID: "retry"}))
+
+	causes := map[string]string{} // dead-letter error by route id, or by raw payload if malformed
+	for range 3 {
+		select {
+		case msg := <-dead:
+			var payload models.RouteMessage
+			key, _ := msg.MessageString()
+			if msg.Decode(&payload) == nil {
+				key = payload.RouteID
+			}
+			causes[key] = msg.Headers().Get(nats.HeaderDeadLetterError)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for dead letter")
+		}
+	}
+	require.Contains(t, causes["not json"], ErrDecode.Error())
+	require.Equal(t, "invalid route", causes["invalid"])
+	require.Equal(t, "always failing", causes["retry"])
+}
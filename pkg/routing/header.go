@@ -0,0 +1,159 @@
+package routing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Well-known header keys carried alongside message payloads.
+const (
+	HeaderTraceID         = "Trace-Id"
+	HeaderContentType     = "Content-Type"
+	HeaderContentEncoding = "Content-Encoding"
+	HeaderTenantID        = "Tenant-Id"
+	HeaderProjectID       = "Project-Id"
+	HeaderSchemaVersion   = "Schema-Version"
+	HeaderRouteID         = "Route-Id"
+	HeaderProcessorID     = "Processor-Id"
+	HeaderClaimCheck      = "Claim-Check"
+	HeaderMsgID           = "Nats-Msg-Id" // JetStream deduplication ID
+)
+
+// Header holds message metadata as key/value pairs. Keys are case-sensitive,
+// matching NATS header semantics, and the type converts directly to nats.Header.
+type Header map[string][]string
+
+// Add appends a value to the values associated with key.
+func (h Header) Add(key, value string) {
+	h[key] = append(h[key], value)
+}
+
+// Set replaces any existing values associated with key.
+func (h Header) Set(key, value string) {
+	h[key] = []string{value}
+}
+
+// Get returns the first value associated with key, or "" if there is none.
+func (h Header) Get(key string) string {
+	if values := h[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns all values associated with key.
+func (h Header) Values(key string) []string {
+	return h[key]
+}
+
+// Del removes all values associated with key.
+func (h Header) Del(key string) {
+	delete(h, key)
+}
+
+// Clone returns a deep copy of the header, or nil if h is nil.
+func (h Header) Clone() Header {
+	if h == nil {
+		return nil
+	}
+	clone := make(Header, len(h))
+	for key, values := range h {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// PublishOptions holds per-message settings applied by Route.Publish and Route.Request.
+type PublishOptions struct {
+	Header Header
+
+	// ContentMsgID derives the message ID from the subject and encoded payload when no ID is set.
+	ContentMsgID bool
+
+	// RetryAttempts is the number of times a JetStream publish is attempted until the stream
+	// acknowledges it, at least once. RetryWait is the wait between attempts.
+	RetryAttempts int
+	RetryWait     time.Duration
+}
+
+// PublishOption defines a function type for configuring a single publish or request.
+type PublishOption func(*PublishOptions)
+
+// WithHeader sets a single header on the published message.
+func WithHeader(key, value string) PublishOption {
+	return func(o *PublishOptions) {
+		if o.Header == nil {
+			o.Header = Header{}
+		}
+		o.Header.Set(key, value)
+	}
+}
+
+// WithHeaders merges all of header into the published message headers.
+func WithHeaders(header Header) PublishOption {
+	return func(o *PublishOptions) {
+		if o.Header == nil {
+			o.Header = Header{}
+		}
+		for key, values := range header {
+			o.Header[key] = append([]string(nil), values...)
+		}
+	}
+}
+
+// WithMsgID sets the message ID used by JetStream to drop duplicates of the message
+// published within the stream duplicate window.
+func WithMsgID(id string) PublishOption {
+	return WithHeader(HeaderMsgID, id)
+}
+
+// WithContentMsgID derives the message ID from a hash of the subject and encoded payload,
+// so republishing the same content within the duplicate window is deduplicated.
+func WithContentMsgID() PublishOption {
+	return func(o *PublishOptions) {
+		o.ContentMsgID = true
+	}
+}
+
+// WithRetry attempts a JetStream publish up to attempts times, waiting wait between attempts,
+// until the stream acknowledges it. Combine with a message ID so retries cannot duplicate.
+func WithRetry(attempts int, wait time.Duration) PublishOption {
+	return func(o *PublishOptions) {
+		o.RetryAttempts = attempts
+		o.RetryWait = wait
+	}
+}
+
+// Idempotent publishes with a content-derived message ID, retrying up to attempts times.
+func Idempotent(attempts int, wait time.Duration) PublishOption {
+	return func(o *PublishOptions) {
+		WithContentMsgID()(o)
+		WithRetry(attempts, wait)(o)
+	}
+}
+
+// ContentMsgID returns the message ID derived from subject and the encoded payload data.
+func ContentMsgID(subject string, data []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(subject))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ApplyMsgID sets the content-derived message ID on header if requested and no ID is set.
+func (o *PublishOptions) ApplyMsgID(header Header, subject string, data []byte) {
+	if o.ContentMsgID && header.Get(HeaderMsgID) == "" {
+		header.Set(HeaderMsgID, ContentMsgID(subject, data))
+	}
+}
+
+// NewPublishOptions applies opts in order and returns the resulting options.
+func NewPublishOptions(opts ...PublishOption) *PublishOptions {
+	options := &PublishOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
@@ -0,0 +1,41 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Shutdowner is implemented by routes that can shut down gracefully.
+type Shutdowner interface {
+	// Shutdown stops receiving new messages, waits until ctx is done for in-flight callbacks,
+	// releases messages that were received but not dispatched for redelivery, and drains the
+	// connection.
+	Shutdown(ctx context.Context) error
+}
+
+// ShutdownOnSignal blocks until the process receives SIGINT or SIGTERM, or ctx is done, and then
+// shuts down routes in order, giving them until timeout to finish their in-flight messages.
+func ShutdownOnSignal(ctx context.Context, timeout time.Duration, routes ...Shutdowner) error {
+	signalCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	<-signalCtx.Done()
+	log.Printf("shutting down %d route(s), waiting up to %s for in-flight messages", len(routes), timeout)
+
+	// the shutdown deadline is independent of ctx, which is typically done by now
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var errs []error
+	for _, route := range routes {
+		if err := route.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
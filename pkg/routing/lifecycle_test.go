@@ -0,0 +1,33 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type shutdownRecorder struct {
+	deadline bool
+	err      error
+}
+
+func (s *shutdownRecorder) Shutdown(ctx context.Context) error {
+	_, s.deadline = ctx.Deadline()
+	return s.err
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	first := &shutdownRecorder{err: errors.New("drain failed")}
+	second := &shutdownRecorder{}
+	err := ShutdownOnSignal(ctx, time.Second, first, second)
+
+	require.ErrorContains(t, err, "drain failed")
+	require.True(t, first.deadline)
+	require.True(t, second.deadline, "every route is shut down despite earlier failures")
+}
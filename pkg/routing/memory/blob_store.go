@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// BlobStore is an in-process stand-in for the S3 client, for use as the claim check store
+// in tests and local development.
+type BlobStore struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewBlobStore creates an empty BlobStore.
+func NewBlobStore() *BlobStore {
+	return &BlobStore{objects: make(map[string][]byte)}
+}
+
+// UploadBytes stores a copy of data under key.
+func (s *BlobStore) UploadBytes(_ context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// DownloadBytes returns the data stored under key.
+func (s *BlobStore) DownloadBytes(_ context.Context, key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, found := s.objects[key]
+	if !found {
+		return nil, fmt.Errorf("object %s not found", key)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Keys returns the keys of all stored objects.
+func (s *BlobStore) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
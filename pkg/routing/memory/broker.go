@@ -0,0 +1,315 @@
+// Package memory provides an in-process implementation of routing.Route.
+//
+// Routes created by this package exchange messages through a Broker that lives
+// entirely in memory. It emulates the subset of NATS and JetStream semantics
+// used by the nats package: core publish/subscribe with queue groups,
+// request/reply, and JetStream streams with durable push and pull consumers,
+// explicit acknowledgement and redelivery. It is intended for tests and for
+// running pipelines locally without a NATS server.
+//
+// A route is served by the in-memory broker when its URL uses the memory://
+// scheme, for example:
+//
+//	routes:
+//	  - selector: processor/usage
+//	    subject: processor.usage
+//	    url: memory://local
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	natslib "github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+)
+
+// DefaultBrokerName is the broker used when a memory:// URL does not name one.
+const DefaultBrokerName = "default"
+
+var (
+	brokersMu sync.Mutex
+	brokers   = make(map[string]*Broker)
+)
+
+// GetBroker returns the named broker, creating it on first use.
+// Routes configured with the same broker name share subjects and streams.
+func GetBroker(name string) *Broker {
+	brokersMu.Lock()
+	defer brokersMu.Unlock()
+
+	if name == "" {
+		name = DefaultBrokerName
+	}
+
+	broker, found := brokers[name]
+	if !found {
+		broker = NewBroker()
+		brokers[name] = broker
+	}
+	return broker
+}
+
+// BrokerForURL resolves a memory://<name> URL to its broker.
+func BrokerForURL(url string) (*Broker, error) {
+	if !strings.HasPrefix(url, nats.MemoryURLScheme) {
+		return nil, fmt.Errorf("url %s is not an in-memory url (expected %s<name>)", url, nats.MemoryURLScheme)
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(url, nats.MemoryURLScheme), "/")
+	return GetBroker(name), nil
+}
+
+// message is the broker's internal representation of a published message.
+type message struct {
+	subject string
+	reply   string
+	data    []byte
+	header  routing.Header
+}
+
+// toMsg builds a fresh nats.Msg for a single delivery, so subscribers never share state.
+func (m *message) toMsg() *natslib.Msg {
+	return &natslib.Msg{
+		Subject: m.subject,
+		Reply:   m.reply,
+		Data:    m.data,
+		Header:  natslib.Header(m.header.Clone()),
+	}
+}
+
+// Broker routes messages between in-memory routes.
+// It holds core subscriptions and JetStream-like streams; it is safe for concurrent use.
+type Broker struct {
+	mu      sync.Mutex
+	subs    map[uint64]*subscription
+	streams map[string]*stream
+	queueRR map[string]uint64 // round-robin counters per queue group
+	nextID  uint64
+}
+
+// NewBroker creates an empty, standalone broker.
+func NewBroker() *Broker {
+	return &Broker{
+		subs:    make(map[uint64]*subscription),
+		streams: make(map[string]*stream),
+		queueRR: make(map[string]uint64),
+	}
+}
+
+// nextSequence returns a broker unique identifier, used for subscriptions, inboxes and ephemeral consumers.
+func (b *Broker) nextSequence() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	return b.nextID
+}
+
+// subscribe registers a core subscription on subject, optionally as part of a queue group.
+func (b *Broker) subscribe(subject, queue string, handler func(*natslib.Msg)) *subscription {
+	sub := newSubscription(subject, queue, handler)
+
+	b.mu.Lock()
+	b.nextID++
+	sub.id = b.nextID
+	b.subs[sub.id] = sub
+	b.mu.Unlock()
+
+	go sub.run()
+	return sub
+}
+
+// unsubscribe removes a core subscription from the broker.
+func (b *Broker) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	delete(b.subs, sub.id)
+	b.mu.Unlock()
+}
+
+// publish delivers msg to all matching core subscriptions (one member per queue group)
+// and stores it in every stream capturing the subject. It returns the number of
+// core subscriptions the message was delivered to and the number of streams that stored it.
+func (b *Broker) publish(msg *message) (delivered int, stored int) {
+	b.mu.Lock()
+	var targets []*subscription
+	groups := make(map[string][]*subscription)
+	for _, sub := range b.subs {
+		if !nats.SubjectMatches(sub.subject, msg.subject) {
+			continue
+		}
+		if sub.queue == "" {
+			targets = append(targets, sub)
+			continue
+		}
+		key := sub.queue + " " + sub.subject
+		groups[key] = append(groups[key], sub)
+	}
+
+	for key, members := range groups {
+		// Sort members so round-robin selection is deterministic.
+		sort.Slice(members, func(i, j int) bool { return members[i].id < members[j].id })
+		idx := b.queueRR[key] % uint64(len(members))
+		b.queueRR[key]++
+		targets = append(targets, members[idx])
+	}
+
+	var streams []*stream
+	for _, s := range b.streams {
+		if s.captures(msg.subject) {
+			streams = append(streams, s)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, sub := range targets {
+		sub.enqueue(msg)
+	}
+
+	for _, s := range streams {
+		b.store(s, msg)
+	}
+
+	return len(targets), len(streams)
+}
+
+// store appends msg to s and to any streams mirroring s.
+func (b *Broker) store(s *stream, msg *message) {
+	if !s.append(msg) {
+		return // duplicate, dropped
+	}
+
+	b.mu.Lock()
+	var mirrors []*stream
+	for _, m := range b.streams {
+		if m.mirror == s.name {
+			mirrors = append(mirrors, m)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, m := range mirrors {
+		b.store(m, msg)
+	}
+}
+
+// addStream creates a stream if it does not already exist and returns it.
+// Streams either capture subjects directly or mirror another stream. Messages with a
+// Nats-Msg-Id already stored within the duplicates window are dropped.
+func (b *Broker) addStream(name string, subjects []string, mirror string, duplicates time.Duration) (*stream, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s, found := b.streams[name]; found {
+		return s, nil
+	}
+
+	if mirror != "" && len(subjects) > 0 {
+		return nil, fmt.Errorf("stream %s cannot define subjects and mirror %s", name, mirror)
+	}
+
+	s := newStream(name, subjects, mirror, duplicates)
+	b.streams[name] = s
+	return s, nil
+}
+
+// streamInfo returns the named stream or natslib.ErrStreamNotFound.
+func (b *Broker) streamInfo(name string) (*stream, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, found := b.streams[name]
+	if !found {
+		return nil, natslib.ErrStreamNotFound
+	}
+	return s, nil
+}
+
+// subscription is a core (non-JetStream) subscription. Messages are queued
+// without bound and handed to the handler in order by a dedicated goroutine,
+// so a slow handler never blocks publishers.
+type subscription struct {
+	id      uint64
+	subject string
+	queue   string
+	handler func(*natslib.Msg)
+
+	mu       sync.Mutex
+	pending  []*message
+	wake     chan struct{}
+	done     chan struct{}
+	closed   bool // no further messages are accepted or delivered
+	draining bool // no further messages are accepted, pending messages are still delivered
+}
+
+func newSubscription(subject, queue string, handler func(*natslib.Msg)) *subscription {
+	return &subscription{
+		subject: subject,
+		queue:   queue,
+		handler: handler,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// enqueue adds msg to the delivery queue unless the subscription is closing.
+func (s *subscription) enqueue(msg *message) {
+	s.mu.Lock()
+	if s.closed || s.draining {
+		s.mu.Unlock()
+		return
+	}
+	s.pending = append(s.pending, msg)
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *subscription) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued messages until the subscription is closed or fully drained.
+func (s *subscription) run() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		if s.closed || (s.draining && len(s.pending) == 0) {
+			s.mu.Unlock()
+			return
+		}
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+			<-s.wake
+			continue
+		}
+		msg := s.pending[0]
+		s.pending[0] = nil
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+
+		s.handler(msg.toMsg())
+	}
+}
+
+// close stops delivery immediately, discarding queued messages.
+func (s *subscription) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.pending = nil
+	s.mu.Unlock()
+	s.signal()
+}
+
+// drain stops accepting messages and blocks until the queued ones have been handled.
+func (s *subscription) drain() {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	s.signal()
+	<-s.done
+}
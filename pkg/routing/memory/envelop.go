@@ -0,0 +1,195 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	natslib "github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+)
+
+// MessageEnvelop encapsulates a message delivered by the in-memory broker.
+// Stream messages support Ack/NakWithDelay with redelivery; core messages behave
+// like core NATS messages and cannot be acknowledged.
+type MessageEnvelop struct {
+	Msg *natslib.Msg // The message associated with this envelope
+
+	broker   *Broker
+	delivery *delivery       // nil for core messages
+	ctx      context.Context // context of the delivery, bounds claim check downloads
+
+	payloadOnce sync.Once // guards payload, fetched from the claim check store on first access if claim checked
+	payload     []byte
+	payloadErr  error
+
+	mu   sync.Mutex
+	ackd bool
+}
+
+func newStreamEnvelop(ctx context.Context, d *delivery) *MessageEnvelop {
+	msg := d.stored.msg.toMsg()
+	return &MessageEnvelop{Msg: msg, delivery: d, ctx: ctx}
+}
+
+func newCoreEnvelop(ctx context.Context, msg *natslib.Msg, broker *Broker) *MessageEnvelop {
+	return &MessageEnvelop{Msg: msg, broker: broker, ctx: ctx}
+}
+
+// Ack acknowledges the message, indicating successful processing.
+func (msg *MessageEnvelop) Ack(_ context.Context) error {
+	if err := msg.settle(); err != nil {
+		return err
+	}
+	msg.delivery.consumer.ack(msg.delivery.stored.seq)
+	return nil
+}
+
+// NakWithDelay acknowledges the message with a negative acknowledgment, allowing it to be redelivered later.
+// Once max_deliver is reached, the message is moved to the dead-letter subject if one is configured.
+func (msg *MessageEnvelop) NakWithDelay(ctx context.Context, delay time.Duration) error {
+	return msg.NakWithError(ctx, delay, nil)
+}
+
+// NakWithError negatively acknowledges the message, recording cause as the last processing error.
+// When the message has been delivered max_deliver times and a dead-letter subject is configured,
+// the message is republished to the dead-letter subject instead of being redelivered.
+func (msg *MessageEnvelop) NakWithError(ctx context.Context, delay time.Duration, cause error) error {
+	if msg.delivery != nil && msg.delivery.consumer.deadLetter != nil && msg.delivery.consumer.exhausted(msg.delivery.deliveries) {
+		return msg.DeadLetter(ctx, cause)
+	}
+
+	if err := msg.settle(); err != nil {
+		return err
+	}
+	msg.delivery.consumer.nak(msg.delivery.stored.seq, delay, cause)
+	return nil
+}
+
+// DeadLetter republishes the message to the configured dead-letter subject and terminates it.
+func (msg *MessageEnvelop) DeadLetter(_ context.Context, cause error) error {
+	if msg.delivery == nil || msg.delivery.consumer.deadLetter == nil {
+		return routing.ErrNoDeadLetter
+	}
+
+	if err := msg.settle(); err != nil {
+		return err
+	}
+	d := msg.delivery
+	d.consumer.deadLetter(d.stored, d.deliveries, cause)
+	d.consumer.ack(d.stored.seq)
+	return nil
+}
+
+// Term terminally acknowledges the message so it is never redelivered.
+func (msg *MessageEnvelop) Term(_ context.Context) error {
+	if err := msg.settle(); err != nil {
+		return err
+	}
+	msg.delivery.consumer.ack(msg.delivery.stored.seq)
+	return nil
+}
+
+// settle marks a stream message as acknowledged, mirroring nats.Msg errors for invalid acks.
+func (msg *MessageEnvelop) settle() error {
+	if msg.delivery == nil {
+		return natslib.ErrMsgNoReply
+	}
+
+	msg.mu.Lock()
+	defer msg.mu.Unlock()
+	if msg.ackd {
+		return natslib.ErrMsgAlreadyAckd
+	}
+	msg.ackd = true
+	return nil
+}
+
+// Metadata returns the JetStream metadata of a stream message.
+func (msg *MessageEnvelop) Metadata() (*natslib.MsgMetadata, error) {
+	if msg.delivery == nil {
+		return nil, natslib.ErrNotJSMessage
+	}
+
+	d := msg.delivery
+	return &natslib.MsgMetadata{
+		Sequence: natslib.SequencePair{
+			Consumer: d.consumerSeq,
+			Stream:   d.stored.seq,
+		},
+		NumDelivered: d.deliveries,
+		NumPending:   d.numPending,
+		Timestamp:    d.stored.timestamp,
+		Stream:       d.consumer.stream.name,
+		Consumer:     d.consumer.name,
+	}, nil
+}
+
+// Respond replies to a request message.
+func (msg *MessageEnvelop) Respond(data []byte) error {
+	if msg.Msg.Reply == "" || msg.broker == nil {
+		return natslib.ErrMsgNoReply
+	}
+	msg.broker.publish(&message{subject: msg.Msg.Reply, data: data})
+	return nil
+}
+
+// Subject returns the subject/topic associated with the message.
+func (msg *MessageEnvelop) Subject() string {
+	return msg.Msg.Subject
+}
+
+// Headers returns the headers published with the message, or nil if there are none.
+func (msg *MessageEnvelop) Headers() routing.Header {
+	return routing.Header(msg.Msg.Header)
+}
+
+// MessageRaw return raw message []byte, fetching claim checked payloads from the claim check store
+// and decompressing according to the Content-Encoding header. Claim checked payloads are fetched
+// once, within the context of the delivery, and shared by concurrent callers.
+func (msg *MessageEnvelop) MessageRaw() ([]byte, error) {
+	if msg.Msg.Data == nil {
+		return nil, errors.New("message is empty")
+	}
+	msg.payloadOnce.Do(func() {
+		ctx := msg.ctx
+		if ctx == nil {
+			ctx = context.Background() // envelope built outside a subscription
+		}
+		msg.payload, msg.payloadErr = routing.ResolveClaimCheck(ctx, msg.Headers(), msg.Msg.Data)
+	})
+	if msg.payloadErr != nil {
+		return nil, msg.payloadErr
+	}
+	return routing.DecompressPayload(msg.Headers(), msg.payload)
+}
+
+// Decode unmarshals the message into v with the codec named by the Content-Type header.
+func (msg *MessageEnvelop) Decode(v any) error {
+	raw, err := msg.MessageRaw()
+	if err != nil {
+		return err
+	}
+	return routing.UnmarshalPayload(msg.Headers(), raw, v)
+}
+
+// MessageString encode raw message bytes in a string.
+func (msg *MessageEnvelop) MessageString() (string, error) {
+	raw, err := msg.MessageRaw()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode raw message in string: %w", err)
+	}
+	return string(raw), nil
+}
+
+// MessageMap return raw message in a map[string]any
+func (msg *MessageEnvelop) MessageMap() (map[string]any, error) {
+	var mapping map[string]any
+	err := msg.Decode(&mapping)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode raw message into map: %w", err)
+	}
+	return mapping, nil
+}
@@ -0,0 +1,550 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	natslib "github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+)
+
+// fetchWait bounds how long a consumer loop blocks before re-checking for shutdown.
+const fetchWait = time.Second
+
+// Route is an in-process implementation of routing.Route.
+// It is configured with the same NatConfig as nats.Route; the URL selects the broker (memory://<name>).
+type Route struct {
+	routing.Route
+
+	Config    *nats.NatConfig
+	Callback  func(ctx context.Context, msg routing.MessageEnvelop)
+	Responder routing.Responder // replies to requests in "request-reply" mode
+
+	broker    *Broker
+	stream    *stream
+	sub       subscriber
+	mu        sync.Mutex
+	connected bool
+
+	asyncOnce sync.Once
+	asyncErrs chan error
+}
+
+// subscriber is implemented by core and JetStream subscriptions held by a Route.
+type subscriber interface {
+	// unsubscribe stops delivery immediately.
+	unsubscribe()
+
+	// drain stops accepting new messages and waits for in-flight callbacks to return.
+	drain()
+}
+
+// NewRoute initializes and returns a new in-memory Route instance.
+func NewRoute(config *nats.NatConfig, callback func(ctx context.Context, msg routing.MessageEnvelop)) *Route {
+	return &Route{
+		Config:   config,
+		Callback: callback,
+	}
+}
+
+// Connect resolves the broker from the route URL, creating the JetStream stream if enabled.
+func (r *Route) Connect(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.connected {
+		return nil // Already connected
+	}
+
+	broker, err := BrokerForURL(r.Config.URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to in-memory broker: %w", err)
+	}
+
+	if r.Config.JetStreamEnabled() {
+		var subjects []string
+		mirror := ""
+		if r.Config.Mirror != nil {
+			mirror = *r.Config.Mirror
+		} else {
+			subjects = []string{r.Config.Subject}
+		}
+
+		duplicates := defaultDuplicateWindow
+		if r.Config.DuplicateWindow != nil {
+			duplicates = time.Duration(*r.Config.DuplicateWindow) * time.Second
+		}
+
+		r.stream, err = broker.addStream(*r.Config.Name, subjects, mirror, duplicates)
+		if err != nil {
+			return fmt.Errorf("failed to add stream: %w", err)
+		}
+	}
+
+	r.broker = broker
+	r.connected = true
+	return nil
+}
+
+// Request sends a request and waits for a reply, returning the response. Without a context
+// deadline, the request times out after the route request timeout. Error replies of responders
+// are returned as a wrapped *routing.ReplyError.
+func (r *Route) Request(ctx context.Context, msg any, opts ...routing.PublishOption) (*natslib.Msg, error) {
+	request, err := r.newMessage(ctx, r.Config.Subject, msg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	if err := r.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Config.RequestTimeoutDuration())
+		defer cancel()
+	}
+
+	inbox := fmt.Sprintf("_INBOX.%d", r.broker.nextSequence())
+	replies := make(chan *natslib.Msg, 1)
+	sub := r.broker.subscribe(inbox, "", func(reply *natslib.Msg) {
+		select {
+		case replies <- reply:
+		default: // only the first reply is returned
+		}
+	})
+	defer func() {
+		r.broker.unsubscribe(sub)
+		sub.close()
+	}()
+
+	request.reply = inbox
+	delivered, _ := r.broker.publish(request)
+	if delivered == 0 {
+		return nil, fmt.Errorf("request failed: %w", natslib.ErrNoResponders)
+	}
+
+	select {
+	case reply := <-replies:
+		if err := routing.ReplyErr(routing.Header(reply.Header), reply.Data); err != nil {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+		return reply, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("request failed: %w", ctx.Err())
+	}
+}
+
+// Publish publishes a message to the subject, either via the stream or as a core message.
+func (r *Route) Publish(ctx context.Context, msg any, opts ...routing.PublishOption) error {
+	return r.publish(ctx, r.Config.Subject, msg, opts...)
+}
+
+// PublishWithSuffix publishes a message to the subject suffixed with ".<suffix>".
+func (r *Route) PublishWithSuffix(ctx context.Context, suffix string, msg any, opts ...routing.PublishOption) error {
+	return r.publish(ctx, fmt.Sprintf("%s.%s", r.Config.Subject, suffix), msg, opts...)
+}
+
+func (r *Route) publish(ctx context.Context, subject string, msg any, opts ...routing.PublishOption) error {
+	published, err := r.newMessage(ctx, subject, msg, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	if err := r.Connect(ctx); err != nil {
+		return err
+	}
+
+	_, stored := r.broker.publish(published)
+	if r.Config.JetStreamEnabled() && stored == 0 {
+		return fmt.Errorf("failed to publish message to JetStream: %w", natslib.ErrNoStreamResponse)
+	}
+
+	return nil
+}
+
+// PublishAsync publishes msg to the subject. The in-memory broker stores messages synchronously,
+// so the returned future is already complete; failures are also sent to AsyncErrors.
+func (r *Route) PublishAsync(ctx context.Context, msg any, opts ...routing.PublishOption) (*routing.PublishFuture, error) {
+	future := routing.NewPublishFuture()
+	if err := r.publish(ctx, r.Config.Subject, msg, opts...); err != nil {
+		asyncErr := &routing.AsyncPublishError{Subject: r.Config.Subject, Err: err}
+		r.AsyncErrors() // ensure the channel exists
+		select {
+		case r.asyncErrs <- asyncErr:
+		default:
+		}
+		future.Complete(asyncErr)
+		return future, nil
+	}
+	future.Complete(nil)
+	return future, nil
+}
+
+// AsyncErrors returns a channel receiving an *routing.AsyncPublishError for every failed async
+// publish. Errors are dropped when the channel is full.
+func (r *Route) AsyncErrors() <-chan error {
+	r.asyncOnce.Do(func() {
+		r.asyncErrs = make(chan error, 64)
+	})
+	return r.asyncErrs
+}
+
+// newMessage serializes msg with the route encoding and builds a broker message for subject, applying
+// publish options such as headers. Oversized payloads are claim checked if enabled.
+func (r *Route) newMessage(ctx context.Context, subject string, msg any, opts ...routing.PublishOption) (*message, error) {
+	encoding, err := r.Config.Encoding()
+	if err != nil {
+		return nil, err
+	}
+
+	options := routing.NewPublishOptions(opts...)
+	header := options.Header.Clone()
+	if header == nil {
+		header = routing.Header{}
+	}
+
+	data, err := encoding.Encode(msg, header)
+	if err != nil {
+		return nil, err
+	}
+	options.ApplyMsgID(header, subject, data)
+
+	if claimCheck := r.Config.ClaimCheck(); claimCheck != nil {
+		if data, err = claimCheck.Check(ctx, data, header); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(header) == 0 {
+		header = nil
+	}
+	return &message{subject: subject, data: data, header: header}, nil
+}
+
+// Subscribe subscribes to the subject, delivering messages to the route callback.
+func (r *Route) Subscribe(ctx context.Context) error {
+	if err := r.Connect(ctx); err != nil {
+		return err
+	}
+
+	mode := "push" // default mode
+	if r.Config.Mode != nil {
+		mode = *r.Config.Mode
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sub != nil {
+		return errors.New("already subscribed")
+	}
+
+	switch {
+	case mode == "request-reply":
+		if r.Responder == nil {
+			return errors.New("request-reply mode requires a responder")
+		}
+		encoding, err := r.Config.Encoding()
+		if err != nil {
+			return err
+		}
+		r.sub = r.subscribeResponder(ctx, encoding)
+	case mode == "pull":
+		if r.stream == nil {
+			return errors.New("failed to subscribe to subject: pull mode requires JetStream (set name + queue in config)")
+		}
+		r.sub = r.subscribeConsumer(ctx, r.pullConsumer(), r.batchSize())
+	case r.Config.Queue != nil && r.stream != nil:
+		r.sub = r.subscribeConsumer(ctx, r.stream.addConsumer(*r.Config.Queue, r.consumerConfig()), 1)
+	default:
+		r.sub = r.subscribeCore(ctx)
+	}
+
+	log.Printf("Subscribed to in-memory subject: %s (mode: %s)\n", r.Config.Subject, mode)
+	return nil
+}
+
+// pullConsumer returns the durable consumer named after the queue, or an ephemeral one.
+func (r *Route) pullConsumer() *consumer {
+	name := ""
+	if r.Config.Queue != nil {
+		name = *r.Config.Queue
+	} else {
+		name = fmt.Sprintf("ephemeral-%d", r.broker.nextSequence())
+	}
+	return r.stream.addConsumer(name, r.consumerConfig())
+}
+
+// consumerConfig builds the consumer delivery settings from the route config.
+func (r *Route) consumerConfig() consumerConfig {
+	cfg := consumerConfig{
+		filter:  r.Config.Subject,
+		backoff: r.Config.BackoffDurations(),
+	}
+	if r.Config.AckWait != nil {
+		cfg.ackWait = time.Duration(*r.Config.AckWait) * time.Second
+	}
+	if r.Config.MaxAckPending != nil {
+		cfg.maxAckPending = *r.Config.MaxAckPending
+	}
+	if r.Config.MaxDeliver != nil {
+		cfg.maxDeliver = *r.Config.MaxDeliver
+	}
+	if r.Config.DeadLetterEnabled() {
+		cfg.deadLetter = r.publishDeadLetter
+	}
+	return cfg
+}
+
+// publishDeadLetter publishes a copy of an exhausted message to the dead-letter subject,
+// with the same headers as nats.Route dead letters.
+func (r *Route) publishDeadLetter(stored *storedMsg, deliveries uint64, cause error) {
+	header := stored.msg.header.Clone()
+	if header == nil {
+		header = routing.Header{}
+	}
+	header.Set(nats.HeaderDeadLetterSubject, stored.msg.subject)
+	header.Set(nats.HeaderDeadLetterDeliveries, strconv.FormatUint(deliveries, 10))
+	header.Set(nats.HeaderDeadLetterStream, *r.Config.Name)
+	header.Set(nats.HeaderDeadLetterSequence, strconv.FormatUint(stored.seq, 10))
+	if cause == nil {
+		cause = nats.ErrMaxDeliveriesExceeded
+	}
+	header.Set(nats.HeaderDeadLetterError, cause.Error())
+
+	r.broker.publish(&message{subject: *r.Config.DeadLetterSubject, data: stored.msg.data, header: header})
+	log.Printf("dead-lettered message: subject=%s, deliveries=%d, dlq=%s", stored.msg.subject, deliveries, *r.Config.DeadLetterSubject)
+}
+
+func (r *Route) batchSize() int {
+	if r.Config.BatchSize != nil && *r.Config.BatchSize > 0 {
+		return *r.Config.BatchSize
+	}
+	return 10 // default
+}
+
+// dispatch invokes the route callback for a single message.
+func (r *Route) dispatch(ctx context.Context, envelop *MessageEnvelop) {
+	if r.Callback == nil {
+		log.Printf("no callback function defined for message on subject: %s", envelop.Subject())
+		return
+	}
+	r.Callback(ctx, envelop)
+}
+
+// subscribeCore creates a core subscription, joining the queue group when one is configured.
+func (r *Route) subscribeCore(ctx context.Context) subscriber {
+	queue := ""
+	if r.Config.Queue != nil {
+		queue = *r.Config.Queue
+	}
+
+	broker := r.broker
+	sub := broker.subscribe(r.Config.Subject, queue, func(msg *natslib.Msg) {
+		r.dispatch(ctx, newCoreEnvelop(ctx, msg, broker))
+	})
+	return &coreSubscriber{broker: broker, sub: sub}
+}
+
+// subscribeConsumer starts a loop fetching up to batch messages at a time from c.
+// The loop serves both push and pull modes; push subscriptions fetch one message at a time.
+func (r *Route) subscribeConsumer(ctx context.Context, c *consumer, batch int) subscriber {
+	s := &consumerSubscriber{
+		consumer:  c,
+		ephemeral: r.Config.Queue == nil,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.stopped)
+		for {
+			deliveries, err := c.fetch(ctx, s.done, batch, fetchWait)
+			if err != nil {
+				if errors.Is(err, natslib.ErrTimeout) {
+					continue // No messages available, keep polling
+				}
+				return // closed or context cancelled
+			}
+
+			for i, d := range deliveries {
+				select {
+				case <-s.done:
+					// Release undispatched messages for immediate redelivery.
+					for _, rest := range deliveries[i:] {
+						c.nak(rest.stored.seq, 0, nil)
+					}
+					return
+				default:
+				}
+				r.dispatch(ctx, newStreamEnvelop(ctx, d))
+			}
+		}
+	}()
+
+	return s
+}
+
+// Reconfigure applies a reloaded config to the route. A subscribed route drains its
+// subscription, so in-flight callbacks complete and unacknowledged stream messages stay
+// pending on the consumer, and then resubscribes with the new settings.
+func (r *Route) Reconfigure(ctx context.Context, config *nats.NatConfig) error {
+	r.mu.Lock()
+	subscribed := r.sub != nil
+	r.drainLocked()
+	r.Config = config
+	r.connected = false
+	r.stream = nil
+	r.mu.Unlock()
+
+	if err := r.Connect(ctx); err != nil {
+		return err
+	}
+	if subscribed {
+		return r.Subscribe(ctx)
+	}
+	return nil
+}
+
+// Unsubscribe stops delivering messages to the callback.
+func (r *Route) Unsubscribe(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sub == nil {
+		return errors.New("not subscribed to in-memory broker")
+	}
+
+	r.sub.unsubscribe()
+	r.sub = nil
+	return nil
+}
+
+// Disconnect drains the subscription and disconnects from the broker.
+func (r *Route) Disconnect(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.connected {
+		return errors.New("not connected to in-memory broker")
+	}
+
+	r.drainLocked()
+	r.connected = false
+	return nil
+}
+
+// Flush returns once all published messages have been handed to the broker.
+// Publishing is synchronous for the in-memory broker, so this only verifies the connection.
+func (r *Route) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.connected {
+		return errors.New("not connected to in-memory broker")
+	}
+	return nil
+}
+
+// Drain stops accepting new messages, waits for in-flight callbacks, and disconnects.
+func (r *Route) Drain() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.connected {
+		return nil // Not connected, nothing to drain
+	}
+
+	r.drainLocked()
+	r.connected = false
+	return nil
+}
+
+// Shutdown stops the route gracefully, like nats.Route.Shutdown: fetching stops, undispatched
+// stream messages are released for redelivery, in-flight callbacks are awaited until ctx is
+// done, and the route disconnects.
+func (r *Route) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	sub := r.sub
+	r.sub = nil
+	r.connected = false
+	r.mu.Unlock()
+
+	if sub == nil {
+		return nil
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		sub.drain()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for in-flight messages: %w", ctx.Err())
+	}
+}
+
+func (r *Route) drainLocked() {
+	if r.sub != nil {
+		r.sub.drain()
+		r.sub = nil
+	}
+}
+
+// coreSubscriber adapts a core broker subscription to the subscriber interface.
+type coreSubscriber struct {
+	broker *Broker
+	sub    *subscription
+}
+
+func (s *coreSubscriber) unsubscribe() {
+	s.broker.unsubscribe(s.sub)
+	s.sub.close()
+}
+
+func (s *coreSubscriber) drain() {
+	s.broker.unsubscribe(s.sub)
+	s.sub.drain()
+}
+
+// consumerSubscriber is a running fetch loop over a stream consumer.
+type consumerSubscriber struct {
+	consumer  *consumer
+	ephemeral bool
+	once      sync.Once
+	done      chan struct{} // closed to stop the fetch loop
+	stopped   chan struct{} // closed once the fetch loop has returned
+}
+
+func (s *consumerSubscriber) stop() {
+	s.once.Do(func() {
+		close(s.done)
+		if s.ephemeral {
+			s.consumer.stream.deleteConsumer(s.consumer.name)
+		}
+	})
+}
+
+func (s *consumerSubscriber) unsubscribe() {
+	s.stop()
+}
+
+func (s *consumerSubscriber) drain() {
+	s.stop()
+	<-s.stopped
+}
@@ -0,0 +1,584 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	natslib "github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+	"github.com/stretchr/testify/require"
+)
+
+type MockData struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// testURL returns a broker URL unique to the test, so tests never share streams.
+func testURL(t *testing.T) string {
+	return nats.MemoryURLScheme + t.Name()
+}
+
+func receive(t *testing.T, ch <-chan routing.MessageEnvelop) routing.MessageEnvelop {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for message")
+		return nil
+	}
+}
+
+func TestRoute_CorePublishSubscribe(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{Selector: "test/core", Subject: "test.core.*", URL: testURL(t)}
+
+	ch := make(chan routing.MessageEnvelop, 1)
+	subscriber := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, subscriber.Subscribe(ctx))
+
+	publisher := NewRoute(&nats.NatConfig{Selector: "test/core", Subject: "test.core", URL: testURL(t)}, nil)
+	require.NoError(t, publisher.PublishWithSuffix(ctx, "abc", MockData{FirstName: "Jane", LastName: "Doe"}))
+
+	msg := receive(t, ch)
+	require.Equal(t, "test.core.abc", msg.Subject())
+	mapping, err := msg.MessageMap()
+	require.NoError(t, err)
+	require.Equal(t, "Jane", mapping["first_name"])
+
+	// core messages cannot be acknowledged
+	require.Error(t, msg.Ack(ctx))
+}
+
+func TestRoute_CoreQueueGroup(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{Selector: "test/queue", Subject: "test.queue", Queue: ptr.String("workers"), URL: testURL(t)}
+
+	var first, second atomic.Int32
+	done := make(chan struct{}, 10)
+	routeA := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { first.Add(1); done <- struct{}{} })
+	routeB := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { second.Add(1); done <- struct{}{} })
+	require.NoError(t, routeA.Subscribe(ctx))
+	require.NoError(t, routeB.Subscribe(ctx))
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, routeA.Publish(ctx, fmt.Sprintf("message %d", i)))
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for messages")
+		}
+	}
+
+	require.Equal(t, int32(5), first.Load())
+	require.Equal(t, int32(5), second.Load())
+}
+
+func TestRoute_Request(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{Selector: "test/request", Subject: "test.request", URL: testURL(t)}
+
+	responder := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) {
+		data, _ := msg.MessageString()
+		require.NoError(t, msg.(*MessageEnvelop).Respond([]byte("hello "+data)))
+	})
+
+	requester := NewRoute(config, nil)
+	_, err := requester.Request(ctx, "world")
+	require.Error(t, err, "request without responders should fail")
+
+	require.NoError(t, responder.Subscribe(ctx))
+
+	reqCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	reply, err := requester.Request(reqCtx, "world")
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(reply.Data))
+}
+
+func TestRoute_Responder(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector:       "test/responder",
+		Subject:        "test.responder",
+		Queue:          ptr.String("test_responders"),
+		Mode:           ptr.String("request-reply"),
+		RequestTimeout: ptr.Int(1),
+		URL:            testURL(t),
+	}
+
+	var served [2]atomic.Int32
+	for i := range served {
+		responder := NewResponderRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) (any, error) {
+			served[i].Add(1)
+
+			var request MockData
+			if err := msg.Decode(&request); err != nil {
+				return nil, err
+			}
+			switch request.FirstName {
+			case "":
+				return nil, routing.NewReplyError("bad_request", "first name is required")
+			case "slow":
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return MockData{FirstName: request.FirstName, LastName: "Doe"}, nil
+		})
+		require.NoError(t, responder.Subscribe(ctx))
+	}
+
+	requester := NewRoute(config, nil)
+	for i := 0; i < 4; i++ {
+		reply, err := requester.Request(ctx, MockData{FirstName: "Jane"})
+		require.NoError(t, err)
+		require.JSONEq(t, `{"first_name":"Jane","last_name":"Doe"}`, string(reply.Data))
+	}
+	// requests are load balanced across the queue group
+	require.Equal(t, int32(2), served[0].Load())
+	require.Equal(t, int32(2), served[1].Load())
+
+	var replyErr *routing.ReplyError
+	_, err := requester.Request(ctx, MockData{})
+	require.ErrorAs(t, err, &replyErr)
+	require.Equal(t, "bad_request", replyErr.Code)
+
+	// the responder gives up after the request timeout, before the requester does
+	reqCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	_, err = requester.Request(reqCtx, MockData{FirstName: "slow"})
+	require.ErrorAs(t, err, &replyErr)
+	require.Equal(t, routing.ReplyErrorTimeout, replyErr.Code)
+}
+
+func TestRoute_ScatterGather(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector: "test/scatter",
+		Subject:  "test.scatter",
+		Mode:     ptr.String("request-reply"),
+		URL:      testURL(t),
+	}
+
+	requester := NewRoute(config, nil)
+	result, err := routing.Gather(ctx, requester, "query", routing.GatherOptions{MaxReplies: 1})
+	require.NoError(t, err)
+	require.ErrorIs(t, result.Err, natslib.ErrNoResponders)
+
+	for _, worker := range []string{"a", "b", "failing"} {
+		responder := NewResponderRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) (any, error) {
+			if worker == "failing" {
+				return nil, routing.NewReplyError("unavailable", "worker is down")
+			}
+			return "reply from " + worker, nil
+		})
+		require.NoError(t, responder.Subscribe(ctx))
+	}
+
+	// every responder receives the request
+	result, err = routing.Gather(ctx, requester, "query", routing.GatherOptions{MaxReplies: 3})
+	require.NoError(t, err)
+	require.NoError(t, result.Err)
+	require.Len(t, result.Replies, 2)
+	require.Len(t, result.Failed, 1)
+	require.NotEmpty(t, result.Failed[0].Responder)
+	require.NotEqual(t, result.Replies[0].Responder, result.Replies[1].Responder)
+
+	var replyErr *routing.ReplyError
+	require.ErrorAs(t, result.Failed[0].Err, &replyErr)
+	require.Equal(t, "unavailable", replyErr.Code)
+
+	// a quorum of successful replies completes the gather
+	result, err = routing.Gather(ctx, requester, "query", routing.GatherOptions{Quorum: 2})
+	require.NoError(t, err)
+	require.NoError(t, result.Err)
+	require.Len(t, result.Replies, 2)
+
+	// a deadline before the target returns partial results
+	gatherCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	result, err = routing.Gather(gatherCtx, requester, "query", routing.GatherOptions{MaxReplies: 4})
+	require.NoError(t, err)
+	require.ErrorIs(t, result.Err, context.DeadlineExceeded)
+	require.Len(t, result.Replies, 2)
+	require.Len(t, result.Failed, 1)
+}
+
+func TestRoute_JetStreamPushAckAndNak(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector: "test/push",
+		Name:     ptr.String("test_push_stream"),
+		Queue:    ptr.String("test_push_consumer"),
+		Subject:  "test.push",
+		URL:      testURL(t),
+	}
+
+	ch := make(chan routing.MessageEnvelop, 4)
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, route.Subscribe(ctx))
+	require.NoError(t, route.Publish(ctx, "payload"))
+
+	msg := receive(t, ch)
+	meta, err := msg.(*MessageEnvelop).Metadata()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), meta.NumDelivered)
+	require.NoError(t, msg.NakWithDelay(ctx, 50*time.Millisecond))
+
+	redelivered := receive(t, ch)
+	meta, err = redelivered.(*MessageEnvelop).Metadata()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), meta.NumDelivered)
+	require.Equal(t, uint64(1), meta.Sequence.Stream)
+	require.NoError(t, redelivered.Ack(ctx))
+	require.Error(t, redelivered.Ack(ctx), "double ack should fail")
+
+	select {
+	case <-ch:
+		t.Fatal("acknowledged message must not be redelivered")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestRoute_JetStreamAckWaitRedelivery(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector: "test/ackwait",
+		Name:     ptr.String("test_ackwait_stream"),
+		Queue:    ptr.String("test_ackwait_consumer"),
+		Subject:  "test.ackwait",
+		URL:      testURL(t),
+		AckWait:  ptr.Int(1),
+	}
+
+	ch := make(chan routing.MessageEnvelop, 4)
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, route.Subscribe(ctx))
+	require.NoError(t, route.Publish(ctx, "payload"))
+
+	receive(t, ch) // never acknowledged
+	redelivered := receive(t, ch)
+	meta, err := redelivered.(*MessageEnvelop).Metadata()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), meta.NumDelivered)
+}
+
+func TestRoute_JetStreamPull(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector:  "test/pull",
+		Name:      ptr.String("test_pull_stream"),
+		Queue:     ptr.String("test_pull_consumer"),
+		Subject:   "test.pull.>",
+		URL:       testURL(t),
+		Mode:      ptr.String("pull"),
+		BatchSize: ptr.Int(5),
+	}
+
+	// messages published before the consumer exists are still delivered
+	publisher := NewRoute(&nats.NatConfig{Selector: "test/pull", Name: config.Name, Queue: config.Queue, Subject: "test.pull", URL: testURL(t)}, nil)
+	require.NoError(t, NewRoute(config, nil).Connect(ctx))
+	for i := 0; i < 20; i++ {
+		require.NoError(t, publisher.PublishWithSuffix(ctx, "item", i))
+	}
+
+	var received atomic.Int32
+	all := make(chan struct{})
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) {
+		require.NoError(t, msg.Ack(ctx))
+		if received.Add(1) == 20 {
+			close(all)
+		}
+	})
+	require.NoError(t, route.Subscribe(ctx))
+
+	select {
+	case <-all:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timeout waiting for messages, received %d", received.Load())
+	}
+
+	// fully acknowledged messages are released by the stream
+	stream, err := route.broker.streamInfo("test_pull_stream")
+	require.NoError(t, err)
+	stream.mu.Lock()
+	require.Empty(t, stream.msgs)
+	stream.mu.Unlock()
+}
+
+func TestRoute_DrainWaitsForInFlight(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{Selector: "test/drain", Subject: "test.drain", URL: testURL(t)}
+
+	var processed atomic.Int32
+	started := make(chan struct{}, 3)
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) {
+		started <- struct{}{}
+		time.Sleep(50 * time.Millisecond)
+		processed.Add(1)
+	})
+	require.NoError(t, route.Subscribe(ctx))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, route.Publish(ctx, "payload"))
+	}
+	<-started
+
+	require.NoError(t, route.Drain())
+	require.Equal(t, int32(3), processed.Load())
+	require.Error(t, route.Flush(), "flush after drain should fail")
+}
+
+func TestRoute_Shutdown(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector:  "test/shutdown",
+		Name:      ptr.String("test_shutdown_stream"),
+		Queue:     ptr.String("test_shutdown_consumer"),
+		Mode:      ptr.String("pull"),
+		BatchSize: ptr.Int(5),
+		Subject:   "test.shutdown",
+		URL:       testURL(t),
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var processed atomic.Int32
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) {
+		if processed.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		require.NoError(t, msg.Ack(ctx))
+	})
+	require.NoError(t, route.Subscribe(ctx))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, route.Publish(ctx, fmt.Sprintf("payload %d", i)))
+	}
+	<-started
+
+	// the in-flight callback outlives the shutdown deadline
+	shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, route.Shutdown(shutdownCtx), context.DeadlineExceeded)
+
+	close(release)
+	require.Error(t, route.Flush(), "flush after shutdown should fail")
+	require.Equal(t, int32(1), processed.Load(), "undispatched messages must not be delivered after shutdown")
+
+	// the undispatched messages are redelivered to the next subscriber
+	ch := make(chan routing.MessageEnvelop, 4)
+	next := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, next.Subscribe(ctx))
+	for i := 0; i < 4; i++ {
+		require.NoError(t, receive(t, ch).Ack(ctx))
+	}
+
+	require.NoError(t, next.Shutdown(ctx))
+}
+
+func TestRoute_Headers(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector: "test/headers",
+		Name:     ptr.String("test_headers_stream"),
+		Queue:    ptr.String("test_headers_consumer"),
+		Subject:  "test.headers",
+		URL:      testURL(t),
+	}
+
+	ch := make(chan routing.MessageEnvelop, 1)
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, route.Subscribe(ctx))
+
+	require.NoError(t, route.Publish(ctx, "payload",
+		routing.WithHeader(routing.HeaderTraceID, "trace-1"),
+		routing.WithHeaders(routing.Header{routing.HeaderContentType: {"text/plain"}})))
+
+	msg := receive(t, ch)
+	require.Equal(t, "trace-1", msg.Headers().Get(routing.HeaderTraceID))
+	require.Equal(t, "text/plain", msg.Headers().Get(routing.HeaderContentType))
+	require.NoError(t, msg.Ack(ctx))
+}
+
+func TestRoute_Codec(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{Selector: "test/codec", Subject: "test.codec", Codec: ptr.String("msgpack+zstd"), URL: testURL(t)}
+
+	ch := make(chan routing.MessageEnvelop, 1)
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, route.Subscribe(ctx))
+	require.NoError(t, route.Publish(ctx, MockData{FirstName: "Jane", LastName: "Doe"}))
+
+	msg := receive(t, ch)
+	require.Equal(t, routing.ContentTypeMsgPack, msg.Headers().Get(routing.HeaderContentType))
+	require.Equal(t, "zstd", msg.Headers().Get(routing.HeaderContentEncoding))
+
+	var decoded MockData
+	require.NoError(t, msg.Decode(&decoded))
+	require.Equal(t, MockData{FirstName: "Jane", LastName: "Doe"}, decoded)
+
+	mapping, err := msg.MessageMap()
+	require.NoError(t, err)
+	require.Equal(t, "Doe", mapping["last_name"])
+}
+
+func TestRoute_ClaimCheck(t *testing.T) {
+	ctx := t.Context()
+	store := NewBlobStore()
+	routing.SetClaimCheckStore(store)
+	t.Cleanup(func() { routing.SetClaimCheckStore(nil) })
+
+	config := &nats.NatConfig{
+		Selector:            "test/claim",
+		Subject:             "test.claim",
+		ClaimCheckThreshold: ptr.Int(64),
+		URL:                 testURL(t),
+	}
+
+	ch := make(chan routing.MessageEnvelop, 2)
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, route.Subscribe(ctx))
+
+	large := MockData{FirstName: strings.Repeat("J", 128), LastName: "Doe"}
+	require.NoError(t, route.Publish(ctx, large))
+	require.NoError(t, route.Publish(ctx, MockData{FirstName: "Jane", LastName: "Doe"}))
+
+	msg := receive(t, ch)
+	key := msg.Headers().Get(routing.HeaderClaimCheck)
+	require.Equal(t, []string{key}, store.Keys())
+	require.True(t, strings.HasPrefix(key, routing.DefaultClaimCheckPrefix))
+
+	var decoded MockData
+	require.NoError(t, msg.Decode(&decoded))
+	require.Equal(t, large, decoded)
+
+	// payloads within the threshold are sent inline
+	msg = receive(t, ch)
+	require.Empty(t, msg.Headers().Get(routing.HeaderClaimCheck))
+	require.Len(t, store.Keys(), 1)
+
+	routing.SetClaimCheckStore(nil)
+	require.ErrorIs(t, route.Publish(ctx, large), routing.ErrClaimCheckStoreNotSet)
+}
+
+func TestRoute_Deduplication(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector: "test/dedup",
+		Name:     ptr.String("test_dedup_stream"),
+		Queue:    ptr.String("test_dedup_consumer"),
+		Subject:  "test.dedup",
+		URL:      testURL(t),
+	}
+
+	ch := make(chan routing.MessageEnvelop, 4)
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, route.Subscribe(ctx))
+
+	require.NoError(t, route.Publish(ctx, "first", routing.WithMsgID("msg-1")))
+	require.NoError(t, route.Publish(ctx, "retried", routing.WithMsgID("msg-1")))
+	require.NoError(t, route.Publish(ctx, MockData{FirstName: "Jane"}, routing.WithContentMsgID()))
+	require.NoError(t, route.Publish(ctx, MockData{FirstName: "Jane"}, routing.WithContentMsgID()))
+	require.NoError(t, route.Publish(ctx, MockData{FirstName: "John"}, routing.WithContentMsgID()))
+
+	var received []string
+	for i := 0; i < 3; i++ {
+		msg := receive(t, ch)
+		data, err := msg.MessageString()
+		require.NoError(t, err)
+		received = append(received, data)
+		require.NoError(t, msg.Ack(ctx))
+	}
+	require.Equal(t, "first", received[0])
+	require.Contains(t, received[1], "Jane")
+	require.Contains(t, received[2], "John")
+
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected duplicate delivered: %v", msg.Subject())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRoute_Reconfigure(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{Selector: "test/reconfigure", Subject: "test.reconfigure.v1", URL: testURL(t)}
+
+	ch := make(chan routing.MessageEnvelop, 2)
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) { ch <- msg })
+	require.NoError(t, route.Subscribe(ctx))
+
+	reloaded := *config
+	reloaded.Subject = "test.reconfigure.v2"
+	require.NoError(t, route.Reconfigure(ctx, &reloaded))
+
+	previous := NewRoute(config, nil)
+	require.NoError(t, previous.Publish(ctx, "old subject"))
+	require.NoError(t, route.Publish(ctx, "new subject"))
+
+	msg := receive(t, ch)
+	require.Equal(t, "test.reconfigure.v2", msg.Subject())
+
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected message on previous subject: %v", msg.Subject())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRoute_DeadLetter(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{
+		Selector:          "test/dlq",
+		Name:              ptr.String("test_dlq_stream"),
+		Queue:             ptr.String("test_dlq_consumer"),
+		Subject:           "test.dlq",
+		URL:               testURL(t),
+		AckWait:           ptr.Int(1),
+		MaxDeliver:        ptr.Int(2),
+		Backoff:           []int{1},
+		DeadLetterSubject: ptr.String("test.dlq.dead"),
+	}
+
+	dead := make(chan routing.MessageEnvelop, 2)
+	dlq := NewRoute(&nats.NatConfig{Selector: "test/dlq/dead", Subject: "test.dlq.dead", URL: testURL(t)},
+		func(ctx context.Context, msg routing.MessageEnvelop) { dead <- msg })
+	require.NoError(t, dlq.Subscribe(ctx))
+
+	var deliveries atomic.Int32
+	route := NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) {
+		deliveries.Add(1)
+		data, _ := msg.MessageString()
+		if data == "nak" {
+			require.NoError(t, msg.(*MessageEnvelop).NakWithError(ctx, 0, fmt.Errorf("processing failed")))
+		}
+		// "timeout" is never acknowledged and exhausts max_deliver through ack wait expiry
+	})
+	require.NoError(t, route.Subscribe(ctx))
+
+	require.NoError(t, route.Publish(ctx, "nak", routing.WithHeader(routing.HeaderTraceID, "trace-1")))
+	msg := receive(t, dead)
+	require.Equal(t, "test.dlq", msg.Headers().Get(nats.HeaderDeadLetterSubject))
+	require.Equal(t, "2", msg.Headers().Get(nats.HeaderDeadLetterDeliveries))
+	require.Equal(t, "processing failed", msg.Headers().Get(nats.HeaderDeadLetterError))
+	require.Equal(t, "trace-1", msg.Headers().Get(routing.HeaderTraceID))
+	require.Equal(t, int32(2), deliveries.Load())
+
+	require.NoError(t, route.Publish(ctx, "timeout"))
+	select {
+	case msg = <-dead:
+	case <-time.After(4 * time.Second):
+		t.Fatal("Timeout waiting for dead letter")
+	}
+	require.Equal(t, nats.ErrMaxDeliveriesExceeded.Error(), msg.Headers().Get(nats.HeaderDeadLetterError))
+	require.Equal(t, int32(4), deliveries.Load())
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	natslib "github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+)
+
+// NewResponderRoute returns an in-memory route serving requests with responder once subscribed,
+// see nats.NewResponderRoute.
+func NewResponderRoute(config *nats.NatConfig, responder routing.Responder) *Route {
+	route := NewRoute(config, nil)
+	route.Responder = responder
+	return route
+}
+
+// subscribeResponder creates a core subscription, joining the queue group when one is configured,
+// replying to requests with the result of the route responder.
+func (r *Route) subscribeResponder(ctx context.Context, encoding *routing.Encoding) subscriber {
+	queue := ""
+	if r.Config.Queue != nil {
+		queue = *r.Config.Queue
+	}
+	timeout := r.Config.RequestTimeoutDuration()
+	responderID := uuid.NewString() // identifies this responder in scatter-gather replies
+
+	broker := r.broker
+	sub := broker.subscribe(r.Config.Subject, queue, func(msg *natslib.Msg) {
+		if msg.Reply == "" {
+			log.Printf("dropping message without reply subject on request-reply subject: %s", msg.Subject)
+			return
+		}
+
+		envelop := newCoreEnvelop(ctx, msg, broker)
+		data, header := routing.HandleRequest(ctx, r.Responder, envelop, encoding, timeout)
+		header.Set(routing.HeaderResponderID, responderID)
+		broker.publish(&message{subject: msg.Reply, data: data, header: header})
+	})
+	return &coreSubscriber{broker: broker, sub: sub}
+}
+
+// ScatterGather publishes msg as a request to every responder on the subject and streams their
+// replies, see nats.Route.ScatterGather.
+func (r *Route) ScatterGather(ctx context.Context, msg any, gather routing.GatherOptions, opts ...routing.PublishOption) (<-chan *routing.Reply, error) {
+	request, err := r.newMessage(ctx, r.Config.Subject, msg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	if err := r.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok {
+		ctx, cancel = context.WithTimeout(ctx, r.Config.RequestTimeoutDuration())
+	}
+
+	inbox := fmt.Sprintf("_INBOX.%d", r.broker.nextSequence())
+	msgs := make(chan *natslib.Msg)
+	done := make(chan struct{})
+	sub := r.broker.subscribe(inbox, "", func(reply *natslib.Msg) {
+		select {
+		case msgs <- reply:
+		case <-done:
+		}
+	})
+	stop := func() {
+		close(done)
+		r.broker.unsubscribe(sub)
+		sub.close()
+		cancel()
+	}
+
+	request.reply = inbox
+	if delivered, _ := r.broker.publish(request); delivered == 0 {
+		// emulate the no responders status sent by a NATS server
+		r.broker.publish(&message{subject: inbox, header: routing.Header{"Status": []string{"503"}}})
+	}
+
+	return routing.GatherReplies(ctx, gather, msgs, stop), nil
+}
@@ -0,0 +1,406 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	natslib "github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+)
+
+const (
+	// defaultAckWait matches the JetStream default consumer ack wait.
+	defaultAckWait = 30 * time.Second
+
+	// defaultMaxAckPending matches the JetStream default consumer max ack pending.
+	defaultMaxAckPending = 1000
+
+	// defaultDuplicateWindow matches the JetStream default stream duplicate window.
+	defaultDuplicateWindow = 2 * time.Minute
+)
+
+// errConsumerClosed is returned by fetch once the subscription owning the fetch has been closed.
+var errConsumerClosed = errors.New("consumer closed")
+
+// storedMsg is a message persisted in a stream.
+type storedMsg struct {
+	seq       uint64
+	msg       *message
+	timestamp time.Time
+}
+
+// stream emulates a JetStream stream with limits retention. Messages are kept
+// until every consumer on the stream has acknowledged them.
+type stream struct {
+	name       string
+	subjects   []string
+	mirror     string
+	duplicates time.Duration // deduplication window of message IDs, mirrors do not deduplicate
+
+	mu        sync.Mutex
+	msgs      []*storedMsg // ordered by sequence
+	lastSeq   uint64
+	consumers map[string]*consumer
+	notify    chan struct{}        // closed and replaced whenever consumers may make progress
+	msgIDs    map[string]time.Time // message IDs stored within the duplicates window
+}
+
+func newStream(name string, subjects []string, mirror string, duplicates time.Duration) *stream {
+	return &stream{
+		name:       name,
+		subjects:   subjects,
+		mirror:     mirror,
+		duplicates: duplicates,
+		consumers:  make(map[string]*consumer),
+		notify:     make(chan struct{}),
+		msgIDs:     make(map[string]time.Time),
+	}
+}
+
+// captures reports whether a message published on subject is stored by this stream.
+func (s *stream) captures(subject string) bool {
+	for _, pattern := range s.subjects {
+		if nats.SubjectMatches(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast wakes all fetchers waiting on the stream. Caller must hold s.mu.
+func (s *stream) broadcast() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// append stores msg at the next sequence, returning false if msg is a duplicate.
+func (s *stream) append(msg *message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if id := msg.header.Get(routing.HeaderMsgID); id != "" && s.mirror == "" {
+		for storedID, stored := range s.msgIDs {
+			if now.Sub(stored) > s.duplicates {
+				delete(s.msgIDs, storedID)
+			}
+		}
+		if _, duplicate := s.msgIDs[id]; duplicate {
+			return false
+		}
+		s.msgIDs[id] = now
+	}
+
+	s.lastSeq++
+	s.msgs = append(s.msgs, &storedMsg{seq: s.lastSeq, msg: msg, timestamp: now})
+	s.broadcast()
+	return true
+}
+
+// lookup returns the stored message for seq, or nil if it was trimmed. Caller must hold s.mu.
+func (s *stream) lookup(seq uint64) *storedMsg {
+	if len(s.msgs) == 0 || seq < s.msgs[0].seq {
+		return nil
+	}
+	idx := seq - s.msgs[0].seq
+	if idx >= uint64(len(s.msgs)) {
+		return nil
+	}
+	return s.msgs[idx]
+}
+
+// consumerConfig holds the delivery settings of a consumer.
+type consumerConfig struct {
+	filter        string
+	ackWait       time.Duration
+	maxAckPending int
+	maxDeliver    int             // 0 for unlimited
+	backoff       []time.Duration // replaces ackWait per delivery attempt when set
+
+	// deadLetter, if set, receives messages that exhausted maxDeliver.
+	deadLetter func(stored *storedMsg, deliveries uint64, cause error)
+}
+
+// addConsumer returns the named consumer, creating it when it does not exist yet and
+// updating its delivery settings otherwise. New consumers deliver all messages currently
+// held by the stream.
+func (s *stream) addConsumer(name string, cfg consumerConfig) *consumer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cfg.ackWait <= 0 {
+		cfg.ackWait = defaultAckWait
+	}
+	if cfg.maxAckPending <= 0 {
+		cfg.maxAckPending = defaultMaxAckPending
+	}
+
+	if c, found := s.consumers[name]; found {
+		c.consumerConfig = cfg
+		s.broadcast() // a larger max ack pending may unblock fetchers
+		return c
+	}
+
+	var cursor uint64
+	if len(s.msgs) > 0 {
+		cursor = s.msgs[0].seq - 1
+	} else {
+		cursor = s.lastSeq
+	}
+
+	c := &consumer{
+		stream:         s,
+		name:           name,
+		consumerConfig: cfg,
+		cursor:         cursor,
+		pending:        make(map[uint64]*pendingMsg),
+	}
+	s.consumers[name] = c
+	return c
+}
+
+// deleteConsumer removes a consumer, releasing any messages only it was holding.
+func (s *stream) deleteConsumer(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.consumers, name)
+	s.trim()
+}
+
+// trim drops messages acknowledged by every consumer. Caller must hold s.mu.
+func (s *stream) trim() {
+	if len(s.consumers) == 0 || len(s.msgs) == 0 {
+		return
+	}
+
+	floor := s.lastSeq + 1
+	for _, c := range s.consumers {
+		if f := c.ackFloor(); f < floor {
+			floor = f
+		}
+	}
+
+	n := 0
+	for n < len(s.msgs) && s.msgs[n].seq < floor {
+		s.msgs[n] = nil
+		n++
+	}
+	s.msgs = s.msgs[n:]
+}
+
+// pendingMsg tracks a delivered message that has not been acknowledged yet.
+type pendingMsg struct {
+	seq        uint64
+	deliveries uint64
+	deadline   time.Time // when the message becomes eligible for redelivery
+	lastErr    error     // last processing error reported with a NAK
+}
+
+// delivery is a single message handed to a subscriber by a consumer.
+type delivery struct {
+	consumer    *consumer
+	stored      *storedMsg
+	deliveries  uint64
+	consumerSeq uint64
+	numPending  uint64
+}
+
+// consumer emulates a durable (or ephemeral) JetStream consumer with explicit acks.
+// All state is guarded by the owning stream's mutex.
+type consumer struct {
+	consumerConfig
+	stream *stream
+	name   string
+
+	cursor       uint64 // last stream sequence considered for first delivery
+	deliveredSeq uint64 // consumer sequence, incremented per delivery
+	pending      map[uint64]*pendingMsg
+}
+
+// ackFloor returns the lowest stream sequence that is not yet acknowledged. Caller must hold stream.mu.
+func (c *consumer) ackFloor() uint64 {
+	floor := c.cursor + 1
+	for seq := range c.pending {
+		if seq < floor {
+			floor = seq
+		}
+	}
+	return floor
+}
+
+// redeliveryDelay returns how long a delivery may remain unacknowledged before it is redelivered.
+func (c *consumer) redeliveryDelay(deliveries uint64) time.Duration {
+	if len(c.backoff) == 0 {
+		return c.ackWait
+	}
+	idx := int(deliveries) - 1
+	if idx >= len(c.backoff) {
+		idx = len(c.backoff) - 1
+	}
+	return c.backoff[idx]
+}
+
+// exhausted reports whether a message delivered deliveries times must not be redelivered.
+func (c *consumer) exhausted(deliveries uint64) bool {
+	return c.maxDeliver > 0 && deliveries >= uint64(c.maxDeliver)
+}
+
+// exhaustedMsg is a message removed from a consumer after reaching maxDeliver.
+type exhaustedMsg struct {
+	stored     *storedMsg
+	deliveries uint64
+	cause      error
+}
+
+// collect gathers up to batch messages ready for delivery: expired or nak'd
+// messages first, then new messages, bounded by maxAckPending. Messages that
+// reached maxDeliver are removed and returned separately. Caller must hold stream.mu.
+func (c *consumer) collect(batch int, now time.Time) ([]*delivery, []exhaustedMsg) {
+	s := c.stream
+	var out []*delivery
+	var exhausted []exhaustedMsg
+
+	var ready []*pendingMsg
+	for _, p := range c.pending {
+		if !now.Before(p.deadline) {
+			ready = append(ready, p)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i].seq < ready[j].seq })
+
+	for _, p := range ready {
+		if len(out) >= batch {
+			return out, exhausted
+		}
+		stored := s.lookup(p.seq)
+		if stored == nil {
+			delete(c.pending, p.seq)
+			continue
+		}
+		if c.exhausted(p.deliveries) {
+			delete(c.pending, p.seq)
+			exhausted = append(exhausted, exhaustedMsg{stored: stored, deliveries: p.deliveries, cause: p.lastErr})
+			continue
+		}
+		p.deliveries++
+		p.deadline = now.Add(c.redeliveryDelay(p.deliveries))
+		out = append(out, c.newDelivery(stored, p.deliveries))
+	}
+
+	for len(out) < batch && len(c.pending) < c.maxAckPending && c.cursor < s.lastSeq {
+		c.cursor++
+		stored := s.lookup(c.cursor)
+		if stored == nil || (c.filter != "" && !nats.SubjectMatches(c.filter, stored.msg.subject)) {
+			continue
+		}
+		c.pending[stored.seq] = &pendingMsg{seq: stored.seq, deliveries: 1, deadline: now.Add(c.redeliveryDelay(1))}
+		out = append(out, c.newDelivery(stored, 1))
+	}
+
+	if len(exhausted) > 0 {
+		s.trim()
+	}
+	return out, exhausted
+}
+
+func (c *consumer) newDelivery(stored *storedMsg, deliveries uint64) *delivery {
+	c.deliveredSeq++
+	return &delivery{
+		consumer:    c,
+		stored:      stored,
+		deliveries:  deliveries,
+		consumerSeq: c.deliveredSeq,
+		numPending:  c.stream.lastSeq - c.cursor,
+	}
+}
+
+// nextDeadline returns the earliest redelivery deadline, or the zero time if nothing is pending.
+// Caller must hold stream.mu.
+func (c *consumer) nextDeadline() time.Time {
+	var next time.Time
+	for _, p := range c.pending {
+		if next.IsZero() || p.deadline.Before(next) {
+			next = p.deadline
+		}
+	}
+	return next
+}
+
+// fetch waits up to maxWait for at least one message and returns up to batch messages.
+// It returns natslib.ErrTimeout when no messages arrive in time, and errConsumerClosed
+// once done is closed.
+func (c *consumer) fetch(ctx context.Context, done <-chan struct{}, batch int, maxWait time.Duration) ([]*delivery, error) {
+	s := c.stream
+	expires := time.Now().Add(maxWait)
+
+	for {
+		s.mu.Lock()
+		out, exhausted := c.collect(batch, time.Now())
+		next := c.nextDeadline()
+		notify := s.notify
+		s.mu.Unlock()
+
+		// Dead-letter outside the stream lock, the dead-letter subject may be captured by this stream.
+		if c.deadLetter != nil {
+			for _, e := range exhausted {
+				c.deadLetter(e.stored, e.deliveries, e.cause)
+			}
+		}
+
+		if len(out) > 0 {
+			return out, nil
+		}
+
+		wait := time.Until(expires)
+		if wait <= 0 {
+			return nil, natslib.ErrTimeout
+		}
+		if !next.IsZero() {
+			if untilNext := time.Until(next); untilNext < wait {
+				wait = untilNext
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-notify:
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return nil, errConsumerClosed
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// ack acknowledges seq, allowing the stream to release it.
+func (c *consumer) ack(seq uint64) {
+	s := c.stream
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(c.pending, seq)
+	s.trim()
+	s.broadcast()
+}
+
+// nak schedules seq for redelivery after delay, recording cause as its last processing error.
+func (c *consumer) nak(seq uint64, delay time.Duration, cause error) {
+	s := c.stream
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, found := c.pending[seq]; found {
+		p.deadline = time.Now().Add(delay)
+		p.lastErr = cause
+	}
+	s.broadcast()
+}
@@ -0,0 +1,267 @@
+package nats
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the ConcurrentRoute queue wait and processing latency histograms.
+var LatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+}
+
+// Histogram counts observed durations in LatencyBuckets. Counts[i] holds the observations at or
+// below Buckets[i] and above the previous bound; the last count holds those above every bound.
+type Histogram struct {
+	Buckets []time.Duration
+	Counts  []uint64
+	Count   uint64
+	Sum     time.Duration
+}
+
+func newHistogram() Histogram {
+	return Histogram{Buckets: LatencyBuckets, Counts: make([]uint64, len(LatencyBuckets)+1)}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.Buckets) && d > h.Buckets[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// Mean returns the average observed duration, or 0 without observations.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket holding the q quantile (0 < q <= 1), which
+// overestimates it by at most the bucket width. Observations above every bound report the last one.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 || len(h.Buckets) == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.Count) + 0.5)
+	var seen uint64
+	for i, bound := range h.Buckets {
+		seen += h.Counts[i]
+		if seen >= rank {
+			return bound
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+// ConcurrentMetrics is a snapshot of the processing metrics of a ConcurrentRoute.
+type ConcurrentMetrics struct {
+	MaxWorkers  int       // current worker pool size
+	InFlight    int       // callbacks currently executing
+	Processed   uint64    // callbacks completed
+	Failed      uint64    // completed callbacks that did not Ack their message
+	Redelivered uint64    // messages received with a delivery count above one
+	Throttled   uint64    // messages that waited for a free worker
+	QueueWait   Histogram // time fetched messages waited for a free worker
+	Latency     Histogram // callback processing time
+}
+
+// concurrentMetrics records the metrics of a ConcurrentRoute.
+type concurrentMetrics struct {
+	mu          sync.Mutex
+	processed   uint64
+	failed      uint64
+	redelivered uint64
+	throttled   uint64
+	queueWait   Histogram
+	latency     Histogram
+}
+
+func newConcurrentMetrics() *concurrentMetrics {
+	return &concurrentMetrics{queueWait: newHistogram(), latency: newHistogram()}
+}
+
+func (m *concurrentMetrics) dispatched(wait time.Duration, throttled, redelivered bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueWait.observe(wait)
+	if throttled {
+		m.throttled++
+	}
+	if redelivered {
+		m.redelivered++
+	}
+}
+
+func (m *concurrentMetrics) completed(latency time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency.observe(latency)
+	m.processed++
+	if failed {
+		m.failed++
+	}
+}
+
+func (m *concurrentMetrics) snapshot() ConcurrentMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return ConcurrentMetrics{
+		Processed:   m.processed,
+		Failed:      m.failed,
+		Redelivered: m.redelivered,
+		Throttled:   m.throttled,
+		QueueWait:   m.queueWait.clone(),
+		Latency:     m.latency.clone(),
+	}
+}
+
+// workerLimiter bounds the number of concurrent workers to a limit that can change at runtime.
+// Shrinking it lets in-flight workers finish; new workers start once the active count drops below it.
+type workerLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	wake   chan struct{} // closed and replaced whenever a worker slot may have become free
+}
+
+func newWorkerLimiter(limit int) *workerLimiter {
+	return &workerLimiter{limit: max(limit, 1), wake: make(chan struct{})}
+}
+
+// acquire takes a worker slot, blocking until one is free or ctx is done. It reports whether it
+// had to wait.
+func (l *workerLimiter) acquire(ctx context.Context) (waited bool, err error) {
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return waited, nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		waited = true
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return waited, ctx.Err()
+		}
+	}
+}
+
+func (l *workerLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.notify()
+}
+
+func (l *workerLimiter) resize(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = max(limit, 1)
+	l.notify()
+}
+
+func (l *workerLimiter) stats() (limit, active int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit, l.active
+}
+
+// notify wakes the waiting acquirers; l.mu must be held.
+func (l *workerLimiter) notify() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// AutoTuneConfig configures the AIMD tuning of a ConcurrentRoute worker pool. Every interval,
+// the pool shrinks by DecreaseFactor when the callbacks of the interval failed above MaxErrorRate
+// or averaged above TargetLatency, and otherwise grows by one worker if messages had to wait for one.
+//
+// A partitioned route runs at most one callback per lane, so its pool starts at the partition
+// count and never waits for a worker until tuning shrank it. AutoTune caps its MaxWorkers at the
+// partition count, so tuning shrinks the pool and grows it back, never beyond one worker per lane.
+type AutoTuneConfig struct {
+	MinWorkers     int           // lower bound of the pool; defaults to 1
+	MaxWorkers     int           // upper bound of the pool; defaults to twice the pool size when tuning starts
+	TargetLatency  time.Duration // average callback latency to stay under; 0 disables the latency check
+	MaxErrorRate   float64       // share of failed callbacks to stay under; 0 disables the error check
+	DecreaseFactor float64       // multiplier applied on decrease; defaults to 0.5
+	Interval       time.Duration // tuning period; defaults to 10s
+}
+
+func (c AutoTuneConfig) withDefaults(workers int) AutoTuneConfig {
+	if c.MinWorkers < 1 {
+		c.MinWorkers = 1
+	}
+	if c.MaxWorkers < c.MinWorkers {
+		c.MaxWorkers = max(2*workers, c.MinWorkers)
+	}
+	if c.DecreaseFactor <= 0 || c.DecreaseFactor >= 1 {
+		c.DecreaseFactor = 0.5
+	}
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+	return c
+}
+
+// next returns the pool size following workers, given the metrics of the interval that just ended.
+func (c AutoTuneConfig) next(workers int, window ConcurrentMetrics) int {
+	overloaded := false
+	if window.Processed > 0 {
+		errorRate := float64(window.Failed) / float64(window.Processed)
+		overloaded = (c.MaxErrorRate > 0 && errorRate > c.MaxErrorRate) ||
+			(c.TargetLatency > 0 && window.Latency.Mean() > c.TargetLatency)
+	}
+
+	switch {
+	case overloaded:
+		workers = int(float64(workers) * c.DecreaseFactor)
+	case window.Throttled > 0:
+		workers++
+	}
+	return min(max(workers, c.MinWorkers), c.MaxWorkers)
+}
+
+// delta returns the metrics recorded between the prev and m snapshots.
+func (m ConcurrentMetrics) delta(prev ConcurrentMetrics) ConcurrentMetrics {
+	return ConcurrentMetrics{
+		MaxWorkers:  m.MaxWorkers,
+		InFlight:    m.InFlight,
+		Processed:   m.Processed - prev.Processed,
+		Failed:      m.Failed - prev.Failed,
+		Redelivered: m.Redelivered - prev.Redelivered,
+		Throttled:   m.Throttled - prev.Throttled,
+		QueueWait:   m.QueueWait.delta(prev.QueueWait),
+		Latency:     m.Latency.delta(prev.Latency),
+	}
+}
+
+func (h Histogram) delta(prev Histogram) Histogram {
+	d := h.clone()
+	if len(prev.Counts) != len(d.Counts) {
+		return d
+	}
+	for i := range d.Counts {
+		d.Counts[i] -= prev.Counts[i]
+	}
+	d.Count -= prev.Count
+	d.Sum -= prev.Sum
+	return d
+}
@@ -0,0 +1,119 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram()
+	for _, d := range []time.Duration{500 * time.Microsecond, 3 * time.Millisecond, 4 * time.Millisecond, 20 * time.Millisecond, time.Minute} {
+		h.observe(d)
+	}
+
+	if h.Count != 5 {
+		t.Errorf("expected 5 observations, got %d", h.Count)
+	}
+	if h.Counts[0] != 1 || h.Counts[1] != 2 || h.Counts[3] != 1 || h.Counts[len(h.Counts)-1] != 1 {
+		t.Errorf("unexpected bucket counts: %v", h.Counts)
+	}
+	if got := h.Quantile(0.5); got != 5*time.Millisecond {
+		t.Errorf("expected median bound 5ms, got %s", got)
+	}
+	if got := h.Quantile(1); got != 30*time.Second {
+		t.Errorf("expected max bound 30s, got %s", got)
+	}
+
+	prev := h.clone()
+	h.observe(2 * time.Millisecond)
+	delta := h.delta(prev)
+	if delta.Count != 1 || delta.Counts[1] != 1 || delta.Sum != 2*time.Millisecond {
+		t.Errorf("unexpected histogram delta: %+v", delta)
+	}
+}
+
+func TestWorkerLimiterResize(t *testing.T) {
+	ctx := context.Background()
+	limiter := newWorkerLimiter(1)
+
+	if waited, err := limiter.acquire(ctx); err != nil || waited {
+		t.Fatalf("expected a free slot, got waited=%v err=%v", waited, err)
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		waited, err := limiter.acquire(ctx)
+		acquired <- waited && err == nil
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired a slot above the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	limiter.resize(2)
+	select {
+	case ok := <-acquired:
+		if !ok {
+			t.Error("expected the waiting acquire to succeed after growing the pool")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("growing the pool did not wake the waiting acquire")
+	}
+
+	limiter.resize(1)
+	limiter.release()
+	cancelled, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(cancelled); err == nil {
+		t.Error("expected acquire to block while in-flight workers exceed the shrunk pool")
+	}
+
+	limiter.release()
+	if limit, active := limiter.stats(); limit != 1 || active != 0 {
+		t.Errorf("expected limit 1 with no active workers, got %d/%d", limit, active)
+	}
+}
+
+func TestAutoTuneNext(t *testing.T) {
+	config := AutoTuneConfig{MinWorkers: 2, MaxWorkers: 10, TargetLatency: 100 * time.Millisecond, MaxErrorRate: 0.2}.withDefaults(8)
+
+	window := func(processed, failed, throttled uint64, latency time.Duration) ConcurrentMetrics {
+		h := newHistogram()
+		for range processed {
+			h.observe(latency)
+		}
+		return ConcurrentMetrics{Processed: processed, Failed: failed, Throttled: throttled, Latency: h}
+	}
+
+	tests := []struct {
+		name    string
+		workers int
+		window  ConcurrentMetrics
+		want    int
+	}{
+		{"healthy and throttled grows", 8, window(100, 0, 5, 10*time.Millisecond), 9},
+		{"growth capped at max", 10, window(100, 0, 5, 10*time.Millisecond), 10},
+		{"healthy and idle holds", 8, window(100, 0, 0, 10*time.Millisecond), 8},
+		{"errors halve", 8, window(100, 30, 5, 10*time.Millisecond), 4},
+		{"slow callbacks halve", 8, window(100, 0, 5, time.Second), 4},
+		{"decrease floored at min", 3, window(100, 50, 0, 10*time.Millisecond), 2},
+		{"no traffic holds", 8, window(0, 0, 0, 0), 8},
+	}
+	for _, tt := range tests {
+		if got := config.next(tt.workers, tt.window); got != tt.want {
+			t.Errorf("%s: expected %d workers, got %d", tt.name, tt.want, got)
+		}
+	}
+
+	// without an explicit bound, the pool can grow above its starting size
+	defaults := AutoTuneConfig{}.withDefaults(8)
+	if defaults.MaxWorkers != 16 {
+		t.Errorf("expected default max workers 16, got %d", defaults.MaxWorkers)
+	}
+	if got := defaults.next(8, window(100, 0, 5, 10*time.Millisecond)); got != 9 {
+		t.Errorf("expected default config to grow to 9 workers, got %d", got)
+	}
+}
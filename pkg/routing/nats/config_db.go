@@ -17,7 +17,8 @@ import (
 //	  "name": "task-stream",      // optional - JetStream stream name
 //	  "queue": "task-workers",     // optional - queue group name
 //	  "subject": "task.process",
-//	  "url": "nats://localhost:4222"
+//	  "url": "nats://localhost:4222",
+//	  "credentials": "/etc/nats/task.creds" // optional - connection settings use the YAML keys
 //	}
 func LoadConfigFromProvider(provider *processor.Provider) (*Config, error) {
 	if provider == nil {
@@ -61,6 +62,10 @@ func UnmarshalProviderRouting(routingJSON data.JSON) (*Config, error) {
 		},
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid routing config: %w", err)
+	}
+
 	// Build the route maps for fast lookups
 	config.BuildRouteMaps()
 
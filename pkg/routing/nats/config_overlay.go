@@ -0,0 +1,138 @@
+package nats
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/quantumwake/alethic-ism-core-go/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Routing configs are layered: a base file holds the routes shared by every environment, and
+// overlay files hold the settings that differ per environment, e.g.
+//
+//	# routing-nats.yaml
+//	messageConfig:
+//	  routes:
+//	    - selector: processor/usage
+//	      subject: processor.usage
+//	      name: usage_stream
+//	      queue: usage_consumer
+//	      url: ${NATS_URL:-nats://localhost:4222}
+//
+//	# routing-nats.prod.yaml
+//	messageConfig:
+//	  routes:
+//	    - selector: processor/usage
+//	      name: prod_usage_stream
+//
+// Overlay routes are merged into the base route with the same selector, overriding only the
+// settings they set; routes with a new selector are added. ${VAR} and ${VAR:-default}
+// references are replaced with environment variables in every file before parsing.
+
+// overlayConfig is a routing config whose routes are kept as YAML nodes, so they can be
+// decoded on top of the base routes.
+type overlayConfig struct {
+	MessageConfig struct {
+		Routes []yaml.Node `yaml:"routes"`
+	} `yaml:"messageConfig"`
+}
+
+// OverlayPathsFromEnv returns the overlay files listed, comma separated, in ROUTING_OVERLAYS.
+func OverlayPathsFromEnv() []string {
+	var paths []string
+	for _, path := range strings.Split(utils.StringFromEnvWithDefault("ROUTING_OVERLAYS", ""), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// readConfigFiles reads the base routing config followed by its overlays.
+func readConfigFiles(paths []string) ([][]byte, error) {
+	files := make([][]byte, len(paths))
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = data
+	}
+	return files, nil
+}
+
+// unmarshalExpandEnv decodes YAML data into v, interpolating ${VAR:-default} references in scalar
+// values only, so values containing YAML syntax are never parsed as part of the document.
+func unmarshalExpandEnv(data []byte, v any) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	if document.Kind == 0 {
+		return nil // empty document
+	}
+	expandEnvNode(&document)
+	return document.Decode(v)
+}
+
+// expandEnvNode interpolates the environment in the scalar values under node, mapping keys excluded.
+func expandEnvNode(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if expanded := utils.ExpandEnv(node.Value); expanded != node.Value {
+			node.Value = expanded
+			if node.Style == 0 {
+				node.Tag = "" // resolve plain scalars on their expanded value, e.g. as numbers
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			expandEnvNode(node.Content[i])
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			expandEnvNode(child)
+		}
+	}
+}
+
+// mergeOverlay merges the routes of a YAML overlay into config by selector.
+func mergeOverlay(config *Config, data []byte) error {
+	var overlay overlayConfig
+	if err := unmarshalExpandEnv(data, &overlay); err != nil {
+		return err
+	}
+
+	for i := range overlay.MessageConfig.Routes {
+		node := &overlay.MessageConfig.Routes[i]
+
+		var key struct {
+			Selector string `yaml:"selector"`
+		}
+		if err := node.Decode(&key); err != nil {
+			return fmt.Errorf("overlay route %d: %w", i, err)
+		}
+
+		route := findRoute(config.MessageConfig.Routes, key.Selector)
+		if route == nil {
+			config.MessageConfig.Routes = append(config.MessageConfig.Routes, NatConfig{})
+			route = &config.MessageConfig.Routes[len(config.MessageConfig.Routes)-1]
+		}
+		if err := node.Decode(route); err != nil {
+			return fmt.Errorf("overlay route %s: %w", key.Selector, err)
+		}
+	}
+	return nil
+}
+
+// findRoute returns the route with selector, or nil if routes has none.
+func findRoute(routes []NatConfig, selector string) *NatConfig {
+	for i := range routes {
+		if routes[i].Selector == selector {
+			return &routes[i]
+		}
+	}
+	return nil
+}
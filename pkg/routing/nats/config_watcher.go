@@ -0,0 +1,197 @@
+package nats
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/quantumwake/alethic-ism-core-go/pkg/utils"
+)
+
+// ReloadableRoute is a route that can apply a reloaded route configuration.
+type ReloadableRoute interface {
+	Reconfigure(ctx context.Context, config *NatConfig) error
+}
+
+// RouteChange describes a route whose configuration changed on reload. Old is nil for
+// added routes and New is nil for removed routes.
+type RouteChange struct {
+	Selector string
+	Old      *NatConfig
+	New      *NatConfig
+}
+
+// ConfigWatcher keeps a routing Config in sync with its YAML file and overlays. The files are
+// polled and, when their content changes, reloaded; watched routes whose settings changed are reconfigured
+// and change handlers are notified. A file that fails to load keeps the previous config.
+type ConfigWatcher struct {
+	paths    []string // base config followed by its overlays
+	interval time.Duration
+
+	mu       sync.RWMutex
+	config   *Config
+	checksum [sha256.Size]byte
+	routes   map[string][]ReloadableRoute // watched routes by selector
+	handlers []func(changes []RouteChange)
+}
+
+// NewConfigWatcher loads the routing config at path merged with its overlays, to be reloaded
+// every interval once Run is called.
+func NewConfigWatcher(path string, interval time.Duration, overlayPaths ...string) (*ConfigWatcher, error) {
+	w := &ConfigWatcher{
+		paths:    append([]string{path}, overlayPaths...),
+		interval: interval,
+		routes:   make(map[string][]ReloadableRoute),
+	}
+
+	files, err := readConfigFiles(w.paths)
+	if err != nil {
+		return nil, err
+	}
+	if w.config, err = parseConfig(files[0], files[1:]...); err != nil {
+		return nil, err
+	}
+	w.checksum = checksumFiles(files)
+	return w, nil
+}
+
+// NewConfigWatcherFromEnv watches the ROUTING_FILE and ROUTING_OVERLAYS, polling every
+// ROUTING_RELOAD_INTERVAL (default 5s).
+func NewConfigWatcherFromEnv() (*ConfigWatcher, error) {
+	path := utils.StringFromEnvWithDefault("ROUTING_FILE", "../routing-nats.yaml")
+	interval := utils.DurationFromEnvWithDefault("ROUTING_RELOAD_INTERVAL", 5*time.Second)
+
+	w, err := NewConfigWatcher(path, interval, OverlayPathsFromEnv()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routing config: %v", err)
+	}
+	return w, nil
+}
+
+// Config returns the current routing config. The returned config is replaced, not modified, on reload.
+func (w *ConfigWatcher) Config() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.config
+}
+
+// Watch registers route to be reconfigured when the settings of selector change.
+func (w *ConfigWatcher) Watch(selector string, route ReloadableRoute) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.routes[selector] = append(w.routes[selector], route)
+}
+
+// OnChange registers a handler called with the route changes of every reload.
+func (w *ConfigWatcher) OnChange(handler func(changes []RouteChange)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers = append(w.handlers, handler)
+}
+
+// Run polls the config file until ctx is done.
+func (w *ConfigWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Reload(ctx); err != nil {
+				log.Printf("failed to reload routing config %s: %v", w.paths[0], err)
+			}
+		}
+	}
+}
+
+// Reload reloads the config files if their content changed, reconfigures the watched routes of
+// changed selectors and returns the changes.
+func (w *ConfigWatcher) Reload(ctx context.Context) ([]RouteChange, error) {
+	files, err := readConfigFiles(w.paths)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := checksumFiles(files)
+	w.mu.RLock()
+	unchanged := checksum == w.checksum
+	w.mu.RUnlock()
+	if unchanged {
+		return nil, nil
+	}
+
+	config, err := parseConfig(files[0], files[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	changes := diffConfigs(w.config, config)
+	w.config = config
+	w.checksum = checksum
+	handlers := append([]func([]RouteChange){}, w.handlers...)
+	routes := make(map[string][]ReloadableRoute, len(w.routes))
+	for selector, watched := range w.routes {
+		routes[selector] = append([]ReloadableRoute(nil), watched...)
+	}
+	w.mu.Unlock()
+
+	log.Printf("reloaded routing config %s: %d route(s) changed", w.paths[0], len(changes))
+
+	var errs []error
+	for _, change := range changes {
+		if change.New == nil {
+			if len(routes[change.Selector]) > 0 {
+				log.Printf("route %s removed from routing config, keeping its current settings", change.Selector)
+			}
+			continue
+		}
+		for _, route := range routes[change.Selector] {
+			if err := route.Reconfigure(ctx, change.New); err != nil {
+				errs = append(errs, fmt.Errorf("failed to reconfigure route %s: %w", change.Selector, err))
+			}
+		}
+	}
+
+	for _, handler := range handlers {
+		handler(changes)
+	}
+
+	return changes, errors.Join(errs...)
+}
+
+// checksumFiles returns the checksum of the content of all config files.
+func checksumFiles(files [][]byte) [sha256.Size]byte {
+	h := sha256.New()
+	for _, data := range files {
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+	var checksum [sha256.Size]byte
+	copy(checksum[:], h.Sum(nil))
+	return checksum
+}
+
+// diffConfigs returns the routes added, removed or changed between two configs.
+func diffConfigs(previous, current *Config) []RouteChange {
+	var changes []RouteChange
+	for selector, newRoute := range current.selectorMap {
+		oldRoute := previous.selectorMap[selector]
+		if oldRoute == nil || !reflect.DeepEqual(oldRoute, newRoute) {
+			changes = append(changes, RouteChange{Selector: selector, Old: oldRoute, New: newRoute})
+		}
+	}
+	for selector, oldRoute := range previous.selectorMap {
+		if _, found := current.selectorMap[selector]; !found {
+			changes = append(changes, RouteChange{Selector: selector, Old: oldRoute})
+		}
+	}
+	return changes
+}
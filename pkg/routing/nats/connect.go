@@ -0,0 +1,121 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ConnectionState is the state of a route's NATS connection reported to connection handlers.
+type ConnectionState string
+
+const (
+	StateConnected    ConnectionState = "connected"
+	StateDisconnected ConnectionState = "disconnected"
+	StateReconnected  ConnectionState = "reconnected"
+	StateClosed       ConnectionState = "closed"
+)
+
+// ConnectionEvent describes a change of a route's NATS connection state.
+type ConnectionEvent struct {
+	Selector string
+	State    ConnectionState
+	URL      string // server the connection is (or was last) connected to
+	Err      error  // cause of the disconnect, if any
+}
+
+// ConnectionHandler is called on every connection state change, from the NATS client goroutine.
+type ConnectionHandler func(event ConnectionEvent)
+
+// WithConnectionHandler registers a handler notified of connection state changes,
+// e.g. to log them or to surface service readiness.
+func WithConnectionHandler(handler ConnectionHandler) RouteOption {
+	return func(r *Route) {
+		r.connectionHandlers = append(r.connectionHandlers, handler)
+	}
+}
+
+// ConnectOptions returns the NATS client options for the authentication, TLS and
+// reconnect settings of the route.
+func (r *NatConfig) ConnectOptions() ([]nats.Option, error) {
+	name := r.Selector
+	if r.ConnectionName != nil {
+		name = *r.ConnectionName
+	}
+	opts := []nats.Option{nats.Name(name)}
+
+	if r.Credentials != nil {
+		opts = append(opts, nats.UserCredentials(*r.Credentials))
+	}
+	if r.NKeySeed != nil {
+		opt, err := nats.NkeyOptionFromSeed(*r.NKeySeed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load nkey seed: %w", err)
+		}
+		opts = append(opts, opt)
+	}
+	if r.Token != nil {
+		opts = append(opts, nats.Token(*r.Token))
+	}
+	if r.User != nil || r.Password != nil {
+		if r.User == nil || r.Password == nil {
+			return nil, errors.New("user and password must be set together")
+		}
+		opts = append(opts, nats.UserInfo(*r.User, *r.Password))
+	}
+
+	if r.TLSCert != nil || r.TLSKey != nil {
+		if r.TLSCert == nil || r.TLSKey == nil {
+			return nil, errors.New("tls_cert and tls_key must be set together")
+		}
+		opts = append(opts, nats.ClientCert(*r.TLSCert, *r.TLSKey))
+	}
+	if r.TLSCA != nil {
+		opts = append(opts, nats.RootCAs(*r.TLSCA))
+	}
+
+	if r.ConnectTimeout != nil {
+		opts = append(opts, nats.Timeout(time.Duration(*r.ConnectTimeout)*time.Second))
+	}
+	if r.ReconnectWait != nil {
+		opts = append(opts, nats.ReconnectWait(time.Duration(*r.ReconnectWait)*time.Second))
+	}
+	if r.MaxReconnects != nil {
+		opts = append(opts, nats.MaxReconnects(*r.MaxReconnects))
+	}
+
+	return opts, nil
+}
+
+// notify reports a connection state change to the route's connection handlers, or logs it
+// if the route has none.
+func (r *Route) notify(state ConnectionState, nc *nats.Conn, err error) {
+	event := ConnectionEvent{Selector: r.Config.Selector, State: state, URL: nc.ConnectedUrlRedacted(), Err: err}
+	if event.URL == "" {
+		event.URL = r.Config.URL
+	}
+
+	if len(r.connectionHandlers) == 0 {
+		if err != nil {
+			log.Printf("NATS connection %s: selector: %s, url: %s, err: %v", state, event.Selector, event.URL, err)
+		} else {
+			log.Printf("NATS connection %s: selector: %s, url: %s", state, event.Selector, event.URL)
+		}
+		return
+	}
+
+	for _, handler := range r.connectionHandlers {
+		handler(event)
+	}
+}
+
+// IsConnected returns true if the route currently holds an established NATS connection,
+// suitable as a readiness check.
+func (r *Route) IsConnected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.nc != nil && r.nc.IsConnected()
+}
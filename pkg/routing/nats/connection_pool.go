@@ -0,0 +1,175 @@
+package nats
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultConnectionManager is shared by all routes not given a manager with WithConnectionManager.
+var DefaultConnectionManager = NewConnectionManager()
+
+// connectionKey identifies routes that can share a connection: the same server URL and credentials.
+type connectionKey struct {
+	url         string
+	credentials string
+	nkeySeed    string
+	token       string
+	user        string
+	password    string
+	tlsCert     string
+	tlsKey      string
+	tlsCA       string
+}
+
+func newConnectionKey(config *NatConfig) connectionKey {
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return connectionKey{
+		url:         config.URL,
+		credentials: value(config.Credentials),
+		nkeySeed:    value(config.NKeySeed),
+		token:       value(config.Token),
+		user:        value(config.User),
+		password:    value(config.Password),
+		tlsCert:     value(config.TLSCert),
+		tlsKey:      value(config.TLSKey),
+		tlsCA:       value(config.TLSCA),
+	}
+}
+
+// sharedConn is a NATS connection and JetStream context shared by reference counted routes.
+type sharedConn struct {
+	key    connectionKey // key of the connection in the manager, the routes may since have been reconfigured
+	nc     *nats.Conn
+	js     nats.JetStreamContext
+	routes map[*Route]struct{} // routes holding a reference, notified of connection state changes
+}
+
+// notify forwards a connection state change to every route sharing the connection.
+func (c *sharedConn) notify(manager *ConnectionManager, state ConnectionState, nc *nats.Conn, err error) {
+	manager.mu.Lock()
+	routes := make([]*Route, 0, len(c.routes))
+	for route := range c.routes {
+		routes = append(routes, route)
+	}
+	manager.mu.Unlock()
+
+	for _, route := range routes {
+		route.notify(state, nc, err)
+	}
+}
+
+// ConnectionManager shares NATS connections between routes with the same URL and credentials.
+// A connection is opened by the first route acquiring it, using that route's connection
+// settings, and drained and closed when the last route releases it.
+type ConnectionManager struct {
+	mu    sync.Mutex
+	conns map[connectionKey]*sharedConn
+}
+
+// NewConnectionManager creates a ConnectionManager with no open connections.
+func NewConnectionManager() *ConnectionManager {
+	return &ConnectionManager{conns: make(map[connectionKey]*sharedConn)}
+}
+
+// WithConnectionManager sets the manager providing the route's connection, e.g. a dedicated
+// manager to keep the route off the connection shared by other routes.
+func WithConnectionManager(manager *ConnectionManager) RouteOption {
+	return func(r *Route) {
+		r.manager = manager
+	}
+}
+
+// Len returns the number of open connections.
+func (m *ConnectionManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.conns)
+}
+
+// acquire returns the connection for the route, opening it if no other route holds it.
+func (m *ConnectionManager) acquire(r *Route) (*sharedConn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := newConnectionKey(r.Config)
+	if conn, found := m.conns[key]; found && !conn.nc.IsClosed() {
+		conn.routes[r] = struct{}{}
+		return conn, nil
+	}
+
+	opts, err := r.Config.ConnectOptions()
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS connection settings: %w", err)
+	}
+
+	conn := &sharedConn{key: key, routes: map[*Route]struct{}{r: {}}}
+	opts = append(opts,
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			conn.notify(m, StateConnected, nc, nil)
+		}),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			conn.notify(m, StateDisconnected, nc, err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			conn.notify(m, StateReconnected, nc, nil)
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			conn.notify(m, StateClosed, nc, nil)
+		}),
+	)
+
+	if conn.nc, err = nats.Connect(r.Config.URL, opts...); err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	m.conns[key] = conn
+	return conn, nil
+}
+
+// jetStream returns the JetStream context of the connection, creating it on first use.
+func (m *ConnectionManager) jetStream(conn *sharedConn) (nats.JetStreamContext, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if conn.js == nil {
+		js, err := conn.nc.JetStream()
+		if err != nil {
+			return nil, err
+		}
+		conn.js = js
+	}
+	return conn.js, nil
+}
+
+// release drops the route's reference to its connection, draining and closing the
+// connection if no other route holds it.
+func (m *ConnectionManager) release(r *Route, conn *sharedConn) error {
+	m.mu.Lock()
+	delete(conn.routes, r)
+	last := len(conn.routes) == 0
+	if last && m.conns[conn.key] == conn {
+		delete(m.conns, conn.key)
+	}
+	m.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+
+	log.Printf("closing shared NATS connection: %s", conn.nc.ConnectedUrlRedacted())
+	if conn.nc.IsClosed() {
+		return nil
+	}
+	if err := conn.nc.Drain(); err != nil {
+		conn.nc.Close()
+		return fmt.Errorf("failed to drain connection: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+)
+
+// Headers stamped on messages republished to the dead-letter subject.
+const (
+	HeaderDeadLetterSubject    = "Dead-Letter-Subject"
+	HeaderDeadLetterDeliveries = "Dead-Letter-Deliveries"
+	HeaderDeadLetterError      = "Dead-Letter-Error"
+	HeaderDeadLetterStream     = "Dead-Letter-Stream"
+	HeaderDeadLetterSequence   = "Dead-Letter-Sequence"
+)
+
+// ErrMaxDeliveriesExceeded is recorded as the last error of messages the server stopped redelivering,
+// typically because the final delivery was never acknowledged within the ack wait.
+var ErrMaxDeliveriesExceeded = errors.New("max deliveries exceeded")
+
+// maxDeliveriesAdvisory is the subset of the JetStream max deliveries advisory we rely on.
+type maxDeliveriesAdvisory struct {
+	Stream     string `json:"stream"`
+	Consumer   string `json:"consumer"`
+	StreamSeq  uint64 `json:"stream_seq"`
+	Deliveries uint64 `json:"deliveries"`
+}
+
+// NakWithError negatively acknowledges the message, recording cause as the last processing error.
+// When the message has been delivered max_deliver times and a dead-letter subject is configured,
+// the message is republished to the dead-letter subject and terminated instead of being redelivered.
+func (msg *MessageEnvelop) NakWithError(ctx context.Context, delay time.Duration, cause error) error {
+	if msg.route != nil && msg.route.Config.DeadLetterEnabled() {
+		if meta, err := msg.Msg.Metadata(); err == nil && msg.route.Config.DeliveriesExhausted(meta.NumDelivered) {
+			return msg.DeadLetter(ctx, cause)
+		}
+	}
+	return msg.Msg.NakWithDelay(delay)
+}
+
+// DeadLetter republishes the message to the configured dead-letter subject, with the original
+// subject, delivery count and cause in its headers, then terminates it so it is never redelivered.
+func (msg *MessageEnvelop) DeadLetter(_ context.Context, cause error) error {
+	if msg.route == nil || !msg.route.Config.DeadLetterEnabled() {
+		return routing.ErrNoDeadLetter
+	}
+
+	var deliveries, sequence uint64
+	stream := ""
+	if meta, err := msg.Msg.Metadata(); err == nil {
+		deliveries, sequence, stream = meta.NumDelivered, meta.Sequence.Stream, meta.Stream
+	}
+
+	if err := msg.route.publishDeadLetter(msg.Msg.Subject, msg.Msg.Header, msg.Msg.Data, deliveries, stream, sequence, cause); err != nil {
+		return err
+	}
+	return msg.Msg.Term()
+}
+
+// publishDeadLetter publishes a copy of a message to the dead-letter subject.
+// It is persisted via JetStream when a stream captures the dead-letter subject, otherwise published on core NATS.
+func (r *Route) publishDeadLetter(subject string, header nats.Header, data []byte, deliveries uint64, stream string, sequence uint64, cause error) error {
+	dlq := &nats.Msg{
+		Subject: *r.Config.DeadLetterSubject,
+		Data:    data,
+		Header:  nats.Header{},
+	}
+	for key, values := range header {
+		dlq.Header[key] = append([]string(nil), values...)
+	}
+	dlq.Header.Set(HeaderDeadLetterSubject, subject)
+	dlq.Header.Set(HeaderDeadLetterDeliveries, strconv.FormatUint(deliveries, 10))
+	if stream != "" {
+		dlq.Header.Set(HeaderDeadLetterStream, stream)
+		dlq.Header.Set(HeaderDeadLetterSequence, strconv.FormatUint(sequence, 10))
+	}
+	if cause != nil {
+		dlq.Header.Set(HeaderDeadLetterError, cause.Error())
+	}
+
+	if r.js != nil {
+		_, err := r.js.PublishMsg(dlq)
+		if err == nil {
+			log.Printf("dead-lettered message: subject=%s, deliveries=%d, dlq=%s", subject, deliveries, dlq.Subject)
+			return nil
+		}
+		if !errors.Is(err, nats.ErrNoStreamResponse) && !errors.Is(err, nats.ErrNoResponders) {
+			return fmt.Errorf("failed to publish dead letter to JetStream: %w", err)
+		}
+		log.Printf("no stream captures dead letter subject %s, publishing on core NATS", dlq.Subject)
+	}
+
+	if err := r.nc.PublishMsg(dlq); err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+	log.Printf("dead-lettered message: subject=%s, deliveries=%d, dlq=%s", subject, deliveries, dlq.Subject)
+	return nil
+}
+
+// watchMaxDeliveries subscribes to the JetStream max deliveries advisory of a consumer, so that messages
+// the server stops redelivering without an explicit NAK (e.g. ack wait timeouts) still reach the
+// dead-letter subject. The advisory is consumed by a queue group so each message is dead-lettered once.
+func (r *Route) watchMaxDeliveries(stream, consumer string) (*nats.Subscription, error) {
+	if !r.Config.DeadLetterEnabled() || stream == "" || consumer == "" {
+		return nil, nil
+	}
+
+	subject := fmt.Sprintf("$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.%s.%s", stream, consumer)
+	sub, err := r.nc.QueueSubscribe(subject, consumer+"_dead_letter", func(m *nats.Msg) {
+		var advisory maxDeliveriesAdvisory
+		if err := json.Unmarshal(m.Data, &advisory); err != nil {
+			log.Printf("invalid max deliveries advisory on %s: %v", m.Subject, err)
+			return
+		}
+
+		raw, err := r.js.GetMsg(stream, advisory.StreamSeq)
+		if err != nil {
+			log.Printf("unable to load exhausted message: stream=%s, seq=%d: %v", stream, advisory.StreamSeq, err)
+			return
+		}
+
+		if err := r.publishDeadLetter(raw.Subject, raw.Header, raw.Data, advisory.Deliveries, stream, advisory.StreamSeq, ErrMaxDeliveriesExceeded); err != nil {
+			log.Printf("unable to dead-letter exhausted message: stream=%s, seq=%d: %v", stream, advisory.StreamSeq, err)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to max deliveries advisory: %w", err)
+	}
+	return sub, nil
+}
@@ -0,0 +1,81 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Shutdown stops the route gracefully: it stops fetching new messages, waits until ctx is done
+// for in-flight callbacks to complete, negatively acknowledges messages that were fetched but not
+// dispatched so they are redelivered right away, and releases the connection, which is drained
+// once no other route shares it. The connection is released even if ctx expires first.
+func (r *Route) Shutdown(ctx context.Context) error {
+	err := r.stopSubscriptions(ctx)
+	if err != nil {
+		log.Printf("in-flight messages on subject %s did not complete: %v", r.Config.Subject, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		return err
+	}
+	return errors.Join(err, r.release())
+}
+
+// stopSubscriptions stops the pull loop and drains the subscriptions, waiting until ctx is done
+// for in-flight callbacks and messages buffered for ordered processing to complete. Push messages
+// delivered meanwhile are NAK'd.
+func (r *Route) stopSubscriptions(ctx context.Context) error {
+	r.stopping.Store(true)
+
+	r.mu.Lock()
+	stop, done := r.pullStop, r.pullDone
+	subs := []*nats.Subscription{r.sub, r.dlqSub}
+	ordered := r.ordered
+	r.sub, r.dlqSub, r.pullStop, r.pullDone, r.ordered = nil, nil, nil, nil, nil
+	r.mu.Unlock()
+
+	var err error
+	if stop != nil {
+		stop()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = fmt.Errorf("timed out waiting for in-flight messages: %w", ctx.Err())
+		}
+	}
+
+	// drain even after a timeout, so the subscriptions are closed once their callbacks return
+	for _, sub := range subs {
+		if drainErr := drainSubscription(ctx, sub); drainErr != nil && err == nil {
+			err = drainErr
+		}
+	}
+
+	// buffered messages are handled once no more are dispatched, or NAK'd when ctx expires
+	if ordered != nil {
+		if orderedErr := ordered.Shutdown(ctx); orderedErr != nil && err == nil {
+			err = orderedErr
+		}
+	}
+	return err
+}
+
+// nakUndispatched negatively acknowledges JetStream messages that were received but will not be
+// dispatched, so they are redelivered without waiting for the ack wait to expire.
+func nakUndispatched(msgs []*nats.Msg) {
+	for _, msg := range msgs {
+		if _, err := msg.Metadata(); err != nil {
+			continue // core message, nothing to acknowledge
+		}
+		if err := msg.Nak(); err != nil {
+			log.Printf("failed to nak undispatched message on subject %s: %v", msg.Subject, err)
+		}
+	}
+}
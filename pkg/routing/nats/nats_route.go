@@ -2,11 +2,11 @@ package nats
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -15,12 +15,12 @@ import (
 	"github.com/quantumwake/alethic-ism-core-go/pkg/utils"
 )
 
-var (
-	channelTTL = utils.DurationFromEnvWithDefault("SUBJECT_CHANNEL_TTL_DURATION", 10*time.Second)
-)
+// pullFetchWait bounds how long a pull fetch waits for messages.
+var pullFetchWait = utils.DurationFromEnvWithDefault("NATS_PULL_FETCH_WAIT", 5*time.Second)
 
 type RouteOptions struct {
-	EnableChannels bool
+	EnableChannels bool                     // process messages in per-subject order
+	Ordering       *routing.OrderingOptions // ordered processing settings, defaults if nil
 }
 
 // RouteOption defines a function type for configuring Route
@@ -33,29 +33,76 @@ type Route struct {
 	Config  *NatConfig
 	Options *RouteOptions
 
-	nc   *nats.Conn
-	js   nats.JetStreamContext
-	sub  *nats.Subscription
-	mu   sync.Mutex
-	once sync.Once
+	nc     *nats.Conn
+	js     nats.JetStreamContext
+	sub    *nats.Subscription
+	dlqSub *nats.Subscription // max deliveries advisory subscription, when dead-lettering is enabled
+	mu     sync.Mutex
+	once   sync.Once
+
+	Callback  func(ctx context.Context, msg routing.MessageEnvelop)
+	Responder routing.Responder // replies to requests in "request-reply" mode
 
-	Callback func(ctx context.Context, msg routing.MessageEnvelop)
+	// Deprecated: ordered processing no longer keeps a channel per subject, so this cache is
+	// nil. Use OrderingMetrics to inspect the ordering keys being processed.
 	Channels cache.Cache
+
+	ordered *routing.OrderedDispatcher // per-key ordered processing, when channels are enabled
+
+	asyncOnce  sync.Once
+	asyncSlots chan struct{} // bounds async publishes awaiting acknowledgement
+	asyncErrs  chan error
+
+	pullStop context.CancelFunc // stops the pull loop
+	pullDone chan struct{}      // closed once the pull loop exited
+	stopping atomic.Bool        // set while shutting down, push deliveries are NAK'd instead of dispatched
+
+	manager            *ConnectionManager // provides the shared connection, DefaultConnectionManager if nil
+	conn               *sharedConn
+	connectionHandlers []ConnectionHandler
 }
 
 // MessageEnvelop encapsulates a NATS message for processing.
 type MessageEnvelop struct {
 	Msg *nats.Msg // The NATS message associated with this envelope
+
+	route *Route          // The route the message was received on, used for dead-lettering
+	ctx   context.Context // context of the delivery, bounds claim check downloads
+	acked atomic.Bool     // set once the message was acknowledged, read by ConcurrentRoute metrics
+
+	payloadOnce sync.Once // guards payload, fetched from the claim check store on first access if claim checked
+	payload     []byte
+	payloadErr  error
+}
+
+// newMessageEnvelop wraps a message delivered on route within ctx.
+func newMessageEnvelop(ctx context.Context, msg *nats.Msg, route *Route) *MessageEnvelop {
+	return &MessageEnvelop{Msg: msg, route: route, ctx: ctx}
 }
 
 // Ack acknowledges the message, indicating successful processing.
 func (msg *MessageEnvelop) Ack(_ context.Context) error {
-	return msg.Msg.Ack() // TODO need to pass in the opts
+	if err := msg.Msg.Ack(); err != nil { // TODO need to pass in the opts
+		return err
+	}
+	msg.acked.Store(true)
+	return nil
 }
 
 // NakWithDelay acknowledges the message with a negative acknowledgment, allowing it to be redelivered later.
-func (msg *MessageEnvelop) NakWithDelay(_ context.Context, delay time.Duration) error {
-	return msg.Msg.NakWithDelay(delay) // Nack with a delay
+// Once max_deliver is reached, the message is moved to the dead-letter subject if one is configured.
+func (msg *MessageEnvelop) NakWithDelay(ctx context.Context, delay time.Duration) error {
+	return msg.NakWithError(ctx, delay, nil)
+}
+
+// Term terminally acknowledges the message so it is never redelivered.
+func (msg *MessageEnvelop) Term(_ context.Context) error {
+	return msg.Msg.Term()
+}
+
+// Metadata returns the JetStream delivery metadata of the message.
+func (msg *MessageEnvelop) Metadata() (*nats.MsgMetadata, error) {
+	return msg.Msg.Metadata()
 }
 
 // Subject returns the subject/topic associated with the message.
@@ -63,12 +110,38 @@ func (msg *MessageEnvelop) Subject() string {
 	return msg.Msg.Subject
 }
 
-// MessageRaw return raw message []byte.
+// Headers returns the headers published with the message, or nil if there are none.
+func (msg *MessageEnvelop) Headers() routing.Header {
+	return routing.Header(msg.Msg.Header)
+}
+
+// MessageRaw return raw message []byte, fetching claim checked payloads from the claim check store
+// and decompressing according to the Content-Encoding header. Claim checked payloads are fetched
+// once, within the context of the delivery, and shared by concurrent callers.
 func (msg *MessageEnvelop) MessageRaw() ([]byte, error) {
 	if msg.Msg.Data == nil {
 		return nil, errors.New("message is empty")
 	}
-	return msg.Msg.Data, nil
+	msg.payloadOnce.Do(func() {
+		ctx := msg.ctx
+		if ctx == nil {
+			ctx = context.Background() // envelope built outside a subscription
+		}
+		msg.payload, msg.payloadErr = routing.ResolveClaimCheck(ctx, msg.Headers(), msg.Msg.Data)
+	})
+	if msg.payloadErr != nil {
+		return nil, msg.payloadErr
+	}
+	return routing.DecompressPayload(msg.Headers(), msg.payload)
+}
+
+// Decode unmarshals the message into v with the codec named by the Content-Type header.
+func (msg *MessageEnvelop) Decode(v any) error {
+	raw, err := msg.MessageRaw()
+	if err != nil {
+		return err
+	}
+	return routing.UnmarshalPayload(msg.Headers(), raw, v)
 }
 
 // MessageString encode raw message bytes in a string.
@@ -83,26 +156,30 @@ func (msg *MessageEnvelop) MessageString() (string, error) {
 // MessageMap return raw message in a map[string]any
 func (msg *MessageEnvelop) MessageMap() (map[string]any, error) {
 	var mapping map[string]any
-	err := json.Unmarshal(msg.Msg.Data, &mapping)
+	err := msg.Decode(&mapping)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode raw message in string: %w", err)
 	}
 	return mapping, nil
 }
 
-// WithEnableChannels enables channel-based message routing
+// WithEnableChannels enables ordered processing: messages of the same subject are handled one at
+// a time in delivery order, each subject by its own worker, with the default ordering options.
 func WithEnableChannels(enable bool) RouteOption {
 	return func(r *Route) {
 		if r.Options == nil {
 			r.Options = &RouteOptions{}
 		}
 		r.Options.EnableChannels = enable
-		if enable {
-			r.Channels = cache.NewLocalCacheWithOptions(
-				cache.WithOptionTTL(5*time.Minute),
-				cache.WithOptionCleanupInterval(10*time.Minute),
-			)
-		}
+	}
+}
+
+// WithOrderedProcessing enables ordered processing with the given ordering key, queue size,
+// idle teardown and overflow policy, see routing.OrderedDispatcher.
+func WithOrderedProcessing(options routing.OrderingOptions) RouteOption {
+	return func(r *Route) {
+		WithEnableChannels(true)(r)
+		r.Options.Ordering = &options
 	}
 }
 
@@ -163,52 +240,48 @@ func (r *Route) Connect(ctx context.Context) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if r.nc != nil && r.nc.IsConnected() {
-		return nil // Already connected
+	if r.conn != nil {
+		if !r.nc.IsClosed() {
+			return nil // Already connected, or reconnecting
+		}
+		// the shared connection was closed, drop it and acquire a new one
+		_ = r.connectionManager().release(r, r.conn)
 	}
 
-	var err error
-	r.nc, err = nats.Connect(r.Config.URL)
+	conn, err := r.connectionManager().acquire(r)
 	if err != nil {
-		return fmt.Errorf("failed to connect to NATS: %w", err)
+		return err
 	}
+	r.conn, r.nc = conn, conn.nc
 
-	if r.Config.JetStreamEnabled() {
-		r.js, err = r.nc.JetStream()
-		if err != nil {
-			return fmt.Errorf("failed to initialize JetStream: %w", err)
-		}
-
-		if _, err := r.js.StreamInfo(*r.Config.Name); errors.Is(err, nats.ErrStreamNotFound) {
-			var streamCfg nats.StreamConfig
-			if r.Config.Mirror != nil {
-				// Create a mirror stream that replicates from the source stream.
-				streamCfg = nats.StreamConfig{
-					Name:   *r.Config.Name,
-					Mirror: &nats.StreamSource{Name: *r.Config.Mirror},
-				}
-				log.Printf("Creating mirror stream %s from source %s", *r.Config.Name, *r.Config.Mirror)
-			} else {
-				streamCfg = nats.StreamConfig{
-					Name:     *r.Config.Name,
-					Subjects: []string{r.Config.Subject},
-				}
-			}
-			if _, err := r.js.AddStream(&streamCfg); err != nil {
-				return fmt.Errorf("failed to add stream: %w", err)
-			}
-		} else if err != nil {
-			return fmt.Errorf("failed to get stream info: %w", err)
-		}
+	if err := r.initJetStream(); err != nil {
+		return err
 	}
 
 	log.Printf("Connected to NATS: %v, subject: %s\n", r.Config.Name, r.Config.Subject)
 	return nil
 }
 
-// Request sends a request and waits for a reply, returning the response.
-func (r *Route) Request(ctx context.Context, msg any) (*nats.Msg, error) {
-	msgBytes, err := toBytes(msg)
+// initJetStream sets up the JetStream context of the connection and ensures the stream of the
+// route, when JetStream is enabled. The caller must hold r.mu.
+func (r *Route) initJetStream() error {
+	if !r.Config.JetStreamEnabled() {
+		return nil
+	}
+
+	js, err := r.connectionManager().jetStream(r.conn)
+	if err != nil {
+		return fmt.Errorf("failed to initialize JetStream: %w", err)
+	}
+	r.js = js
+	return r.ensureStream()
+}
+
+// Request sends a request and waits for a reply, returning the response. Without a context
+// deadline, the request times out after the route request timeout. Error replies of responders
+// are returned as a wrapped *routing.ReplyError.
+func (r *Route) Request(ctx context.Context, msg any, opts ...routing.PublishOption) (*nats.Msg, error) {
+	natsMsg, _, err := r.newMsg(ctx, r.Config.Subject, msg, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize message: %w", err)
 	}
@@ -217,18 +290,27 @@ func (r *Route) Request(ctx context.Context, msg any) (*nats.Msg, error) {
 		return nil, err
 	}
 
-	resp, err := r.nc.RequestWithContext(ctx, r.Config.Subject, msgBytes)
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Config.RequestTimeoutDuration())
+		defer cancel()
+	}
+
+	resp, err := r.nc.RequestMsgWithContext(ctx, natsMsg)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
+	if err := routing.ReplyErr(routing.Header(resp.Header), resp.Data); err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
 
 	return resp, nil
 }
 
 // Publish publishes a message to the subject, either via JetStream or standard NATS.
 // func (r *NATSRoute) Publish(ctx context.Context, msg any) error {
-func (r *Route) Publish(ctx context.Context, msg any) error {
-	data, err := toBytes(msg)
+func (r *Route) Publish(ctx context.Context, msg any, opts ...routing.PublishOption) error {
+	natsMsg, options, err := r.newMsg(ctx, r.Config.Subject, msg, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to serialize message: %w", err)
 	}
@@ -238,14 +320,14 @@ func (r *Route) Publish(ctx context.Context, msg any) error {
 	}
 
 	if r.Config.JetStreamEnabled() {
-		ack, err := r.js.Publish(r.Config.Subject, data)
+		ack, err := r.publishJetStream(ctx, natsMsg, options)
 		if err != nil {
 			return fmt.Errorf("failed to publish message to JetStream: %w", err)
 		}
 		log.Printf("published to JetStream: stream=%s seq=%d subject=%s size=%d",
-			ack.Stream, ack.Sequence, r.Config.Subject, len(data))
+			ack.Stream, ack.Sequence, r.Config.Subject, len(natsMsg.Data))
 	} else {
-		if err := r.nc.Publish(r.Config.Subject, data); err != nil {
+		if err := r.nc.PublishMsg(natsMsg); err != nil {
 			return fmt.Errorf("failed to publish message: %w", err)
 		}
 	}
@@ -253,10 +335,12 @@ func (r *Route) Publish(ctx context.Context, msg any) error {
 	return nil
 }
 
-func (r *Route) PublishWithSuffix(ctx context.Context, suffix string, msg any) error {
-	var err error
-	var data []byte
-	data, err = toBytes(msg)
+// PublishWithSuffix publishes a message to the subject suffixed with ".<suffix>".
+func (r *Route) PublishWithSuffix(ctx context.Context, suffix string, msg any, opts ...routing.PublishOption) error {
+	// construct the subject with the suffix
+	subject := fmt.Sprintf("%s.%s", r.Config.Subject, suffix)
+
+	natsMsg, options, err := r.newMsg(ctx, subject, msg, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to serialize message: %w", err)
 	}
@@ -265,16 +349,13 @@ func (r *Route) PublishWithSuffix(ctx context.Context, suffix string, msg any) e
 		return err
 	}
 
-	// construct the subject with the suffix
-	subject := fmt.Sprintf("%s.%s", r.Config.Subject, suffix)
-
 	if r.Config.JetStreamEnabled() {
-		_, err = r.js.Publish(subject, data)
+		_, err = r.publishJetStream(ctx, natsMsg, options)
 		if err != nil {
 			return fmt.Errorf("failed to publish message to JetStream: %w", err)
 		}
 	} else {
-		if err = r.nc.Publish(subject, data); err != nil {
+		if err = r.nc.PublishMsg(natsMsg); err != nil {
 			return fmt.Errorf("failed to publish message: %w", err)
 		}
 	}
@@ -287,6 +368,7 @@ func (r *Route) Subscribe(ctx context.Context) error {
 	if err := r.Connect(ctx); err != nil {
 		return err
 	}
+	r.stopping.Store(false)
 
 	mode := "push" // default mode
 	if r.Config.Mode != nil {
@@ -298,9 +380,12 @@ func (r *Route) Subscribe(ctx context.Context) error {
 	}
 
 	var err error
-	if mode == "pull" {
+	switch mode {
+	case "pull":
 		err = r.subscribePull(ctx)
-	} else {
+	case "request-reply":
+		err = r.subscribeResponder(ctx)
+	default:
 		err = r.subscribePush(ctx)
 	}
 
@@ -314,13 +399,17 @@ func (r *Route) Subscribe(ctx context.Context) error {
 
 // subscribePush handles push-based subscription
 func (r *Route) subscribePush(ctx context.Context) error {
+	dispatch := r.newDispatch()
 	callback := func(msg *nats.Msg) {
+		if r.stopping.Load() {
+			nakUndispatched([]*nats.Msg{msg})
+			return
+		}
 		if r.Callback == nil {
 			log.Printf("no callback function defined for message: %v on subject: %s", msg.Data, msg.Subject)
 			return
 		}
-		envelop := &MessageEnvelop{Msg: msg}
-		r.Callback(ctx, envelop)
+		dispatch(ctx, newMessageEnvelop(ctx, msg, r))
 	}
 
 	var err error
@@ -328,6 +417,9 @@ func (r *Route) subscribePush(ctx context.Context) error {
 		log.Printf("Subscribing to queue subject: %s", r.Config.Subject)
 		opts := buildJetStreamOptions(r.Config)
 		r.sub, err = r.js.QueueSubscribe(r.Config.Subject, *r.Config.Queue, callback, opts...)
+		if err == nil && r.Config.Name != nil {
+			r.dlqSub, err = r.watchMaxDeliveries(*r.Config.Name, *r.Config.Queue)
+		}
 	} else {
 		log.Printf("Subscribing to NATS subject: %s", r.Config.Subject)
 		r.sub, err = r.nc.Subscribe(r.Config.Subject, callback)
@@ -367,37 +459,58 @@ func (r *Route) subscribePull(ctx context.Context) error {
 	}
 	r.sub = sub
 
+	if r.Config.Name != nil {
+		if r.dlqSub, err = r.watchMaxDeliveries(*r.Config.Name, durableName); err != nil {
+			return err
+		}
+	}
+
 	log.Printf("Starting pull consumer with batch size: %d", batchSize)
+	dispatch := r.newDispatch()
+
+	// The fetch loop is stopped by Shutdown, Drain and Disconnect, while callbacks keep ctx.
+	loopCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	r.mu.Lock()
+	r.pullStop, r.pullDone = stop, done
+	r.mu.Unlock()
 
 	// Start background goroutine to pull messages
 	go func() {
+		defer close(done)
+		defer stop()
 		for {
-			// Check if context is cancelled before fetching
+			// Check if the loop is stopped before fetching
 			select {
-			case <-ctx.Done():
-				log.Printf("Pull subscriber shutting down: %v", ctx.Err())
+			case <-loopCtx.Done():
+				log.Printf("Pull subscriber shutting down: %v", loopCtx.Err())
 				return
 			default:
 				// Continue to fetch
 			}
 
-			msgs, err := sub.Fetch(batchSize, nats.MaxWait(5*time.Second))
+			fetchCtx, cancel := context.WithTimeout(loopCtx, pullFetchWait)
+			msgs, err := sub.Fetch(batchSize, nats.Context(fetchCtx))
+			cancel()
 			if err != nil {
-				if errors.Is(err, nats.ErrTimeout) {
+				if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) || loopCtx.Err() != nil {
 					continue // No messages available, keep polling
 				}
+				if !sub.IsValid() {
+					log.Printf("Pull subscriber stopped: %v", err)
+					return // unsubscribed, drained or reconfigured
+				}
 				log.Printf("Error fetching messages: %v", err)
 				continue
 			}
 
-			for _, msg := range msgs {
+			for i, msg := range msgs {
+				if loopCtx.Err() != nil {
+					nakUndispatched(msgs[i:])
+					break
+				}
 				if r.Callback != nil {
-					envelop := &MessageEnvelop{Msg: msg}
-					if r.Options != nil && r.Options.EnableChannels {
-						r.publishWithChannel(ctx, envelop)
-					} else {
-						r.Callback(ctx, envelop)
-					}
+					dispatch(ctx, newMessageEnvelop(ctx, msg, r))
 				}
 			}
 		}
@@ -406,30 +519,138 @@ func (r *Route) subscribePull(ctx context.Context) error {
 	return nil
 }
 
-func (r *Route) publishWithChannel(ctx context.Context, msg routing.MessageEnvelop) (chan routing.MessageEnvelop, error) {
-	subject := msg.Subject()
+// newDispatch returns the function handing received messages to the callback. With ordered
+// processing enabled, it starts a new ordered dispatcher, shut down with the subscriptions.
+func (r *Route) newDispatch() func(ctx context.Context, msg *MessageEnvelop) {
+	if r.Options == nil || !r.Options.EnableChannels {
+		return func(ctx context.Context, msg *MessageEnvelop) {
+			r.Callback(ctx, msg)
+		}
+	}
+
+	options := routing.OrderingOptions{}
+	if r.Options.Ordering != nil {
+		options = *r.Options.Ordering
+	}
+	ordered := routing.NewOrderedDispatcher(func(ctx context.Context, msg routing.MessageEnvelop) {
+		r.Callback(ctx, msg)
+	}, options)
+
+	r.mu.Lock()
+	r.ordered = ordered
+	r.mu.Unlock()
 
-	//
-	ch, err := r.Channels.GetCreateOrUpdate(ctx, subject, func(exists bool, value any) (any, error) {
-		// if the channel already exists, then just set it to itself
-		if exists {
-			return value, nil
+	return func(ctx context.Context, msg *MessageEnvelop) {
+		if err := ordered.Dispatch(ctx, msg); err != nil {
+			log.Printf("failed to dispatch message on subject %s: %v", msg.Subject(), err)
 		}
+	}
+}
+
+// OrderingMetrics returns the per-key metrics of ordered processing, or nil if it is not enabled
+// or the route is not subscribed.
+func (r *Route) OrderingMetrics() map[string]routing.KeyMetrics {
+	r.mu.Lock()
+	ordered := r.ordered
+	r.mu.Unlock()
+	if ordered == nil {
+		return nil
+	}
+	return ordered.Metrics()
+}
+
+// Reconfigure applies a reloaded config to the route. A subscribed route drains its
+// subscriptions, so in-flight callbacks complete and unacknowledged JetStream messages are
+// redelivered, updates the durable consumer settings and resubscribes with the new config.
+func (r *Route) Reconfigure(ctx context.Context, config *NatConfig) error {
+	r.mu.Lock()
+	subscribed := r.sub != nil && r.sub.IsValid()
+	r.mu.Unlock()
 
-		// create channel since it does not exist
-		value = make(chan routing.MessageEnvelop, 1)
-		return value, nil
-	}, channelTTL)
+	if err := r.stopSubscriptions(ctx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	previous := r.Config
+	r.Config = config
+	kept := r.conn != nil && !r.nc.IsClosed()
+	if r.conn != nil && newConnectionKey(previous) != newConnectionKey(config) {
+		_ = r.connectionManager().release(r, r.conn)
+		r.conn, r.nc, r.js = nil, nil, nil
+		kept = false
+	}
+	r.mu.Unlock()
 
+	if err := r.Connect(ctx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	var err error
+	if kept {
+		// Connect only sets up JetStream for a new connection
+		err = r.initJetStream()
+	}
+	if err == nil && r.Config.JetStreamEnabled() && r.Config.Queue != nil {
+		err = r.updateConsumer(*r.Config.Name, *r.Config.Queue)
+	}
+	r.mu.Unlock()
 	if err != nil {
-		// TODO critical error here
-		return nil, fmt.Errorf("failed to get or create channel for subject: %s; err: %v", subject, err)
+		return err
+	}
+
+	if subscribed {
+		return r.Subscribe(ctx)
+	}
+	return nil
+}
+
+// updateConsumer applies the consumer settings of the route to an existing durable consumer.
+func (r *Route) updateConsumer(stream, consumer string) error {
+	info, err := r.js.ConsumerInfo(stream, consumer)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		return nil // created on subscribe
+	} else if err != nil {
+		return fmt.Errorf("failed to get consumer info: %w", err)
 	}
 
-	//
-	msgChan := ch.(chan routing.MessageEnvelop)
-	msgChan <- msg
-	return msgChan, nil
+	cfg := info.Config
+	if r.Config.MaxAckPending != nil {
+		cfg.MaxAckPending = *r.Config.MaxAckPending
+	}
+	if r.Config.AckWait != nil {
+		cfg.AckWait = time.Duration(*r.Config.AckWait) * time.Second
+	}
+	if r.Config.MaxDeliver != nil {
+		cfg.MaxDeliver = *r.Config.MaxDeliver
+	}
+	if backoff := r.Config.BackoffDurations(); backoff != nil {
+		cfg.BackOff = backoff
+	}
+
+	if _, err = r.js.UpdateConsumer(stream, &cfg); err != nil {
+		return fmt.Errorf("failed to update consumer %s: %w", consumer, err)
+	}
+	return nil
+}
+
+// drainSubscription drains sub and waits until its pending callbacks completed.
+func drainSubscription(ctx context.Context, sub *nats.Subscription) error {
+	if sub == nil || !sub.IsValid() {
+		return nil
+	}
+	if err := sub.Drain(); err != nil {
+		return fmt.Errorf("failed to drain subscription %s: %w", sub.Subject, err)
+	}
+	for sub.IsValid() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return nil
 }
 
 // Unsubscribe unsubscribes from the subject.
@@ -446,53 +667,63 @@ func (r *Route) Unsubscribe(ctx context.Context) error {
 		return fmt.Errorf("failed to unsubscribe from subject: %w", err)
 	}
 
+	if r.dlqSub != nil {
+		if err = r.dlqSub.Unsubscribe(); err != nil {
+			return fmt.Errorf("failed to unsubscribe from max deliveries advisory: %w", err)
+		}
+		r.dlqSub = nil
+	}
+
 	return nil
 }
 
-// Disconnect drains the connection and closes it.
+// Disconnect drains the route's subscriptions and releases its connection, which is
+// closed once no other route shares it.
 func (r *Route) Disconnect(ctx context.Context) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if r.nc == nil || !r.nc.IsConnected() {
+	if r.conn == nil || !r.nc.IsConnected() {
 		return errors.New("not connected to NATS")
 	}
 
-	err := r.nc.Drain()
+	return r.release()
+}
+
+// newMsg serializes msg with the route encoding and builds a nats.Msg for subject, applying
+// publish options such as headers. Oversized payloads are claim checked if enabled.
+func (r *Route) newMsg(ctx context.Context, subject string, msg any, opts ...routing.PublishOption) (*nats.Msg, *routing.PublishOptions, error) {
+	encoding, err := r.Config.Encoding()
 	if err != nil {
-		return fmt.Errorf("failed to drain connection: %w", err)
+		return nil, nil, err
 	}
 
-	r.nc.Close()
-	return nil
-}
+	options := routing.NewPublishOptions(opts...)
+	header := options.Header
+	if header == nil {
+		header = routing.Header{}
+	}
 
-// toBytes converts a message to a byte slice.
-func toBytes(msg any) ([]byte, error) {
-	var data []byte
-	var err error
+	data, err := encoding.Encode(msg, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	options.ApplyMsgID(header, subject, data)
 
-	switch v := msg.(type) {
-	case []byte:
-		// If it's already a byte array, use it directly
-		data = v
-	case string:
-		// if a string then turn it into bytes
-		return []byte(v), nil
-	case map[string]any:
-		// If it's a map, marshal it to JSON
-		data, err = json.Marshal(v)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal map to JSON: %w", err)
-		}
-	default:
-		// For any other type, try to marshal it to JSON
-		data, err = json.Marshal(v)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal message to JSON: %w", err)
+	if claimCheck := r.Config.ClaimCheck(); claimCheck != nil {
+		if data, err = claimCheck.Check(ctx, data, header); err != nil {
+			return nil, nil, err
 		}
 	}
-	return data, nil
+
+	if len(header) == 0 {
+		header = nil
+	}
+	return &nats.Msg{
+		Subject: subject,
+		Data:    data,
+		Header:  nats.Header(header),
+	}, options, nil
 }
 
 func (r *Route) Flush() error {
@@ -503,18 +734,46 @@ func (r *Route) Flush() error {
 	return r.nc.Flush()
 }
 
-// Drain drains and closes the connection gracefully.
+// Drain drains the route's subscriptions and releases its connection gracefully; the
+// connection itself is drained and closed once no other route shares it.
 func (r *Route) Drain() error {
-	if r.nc == nil || !r.nc.IsConnected() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil || !r.nc.IsConnected() {
 		return nil // Not connected, nothing to drain
 	}
 
-	err := r.nc.Drain()
-	if err != nil {
-		return fmt.Errorf("failed to drain connection: %w", err)
+	return r.release()
+}
+
+// release drains the route's subscriptions and drops its reference to the shared connection.
+// The pull loop is stopped without waiting for its in-flight callback, see Shutdown.
+func (r *Route) release() error {
+	if r.pullStop != nil {
+		r.pullStop()
+	}
+	for _, sub := range []*nats.Subscription{r.sub, r.dlqSub} {
+		if sub == nil || !sub.IsValid() {
+			continue
+		}
+		if err := sub.Drain(); err != nil {
+			return fmt.Errorf("failed to drain subscription %s: %w", sub.Subject, err)
+		}
 	}
+	r.sub, r.dlqSub = nil, nil
 
-	return nil
+	err := r.connectionManager().release(r, r.conn)
+	r.conn, r.nc, r.js = nil, nil, nil
+	return err
+}
+
+// connectionManager returns the manager providing the route's connection.
+func (r *Route) connectionManager() *ConnectionManager {
+	if r.manager == nil {
+		return DefaultConnectionManager
+	}
+	return r.manager
 }
 
 // buildJetStreamOptions builds JetStream consumer options from NatConfig
@@ -532,5 +791,15 @@ func buildJetStreamOptions(config *NatConfig) []nats.SubOpt {
 		log.Printf("Setting AckWait: %v", ackWait)
 	}
 
+	if config.MaxDeliver != nil {
+		opts = append(opts, nats.MaxDeliver(*config.MaxDeliver))
+		log.Printf("Setting MaxDeliver: %d", *config.MaxDeliver)
+	}
+
+	if backoff := config.BackoffDurations(); backoff != nil {
+		opts = append(opts, nats.BackOff(backoff))
+		log.Printf("Setting BackOff: %v", backoff)
+	}
+
 	return opts
 }
@@ -2,12 +2,16 @@
 //
 // ConcurrentRoute extends the base Route to provide concurrent message
 // processing with semaphore-based backpressure. It mirrors the Python
-// NATSRouteConcurrent pattern from alethic-ism-core.
+// NATSRouteConcurrent pattern from alethic-ism-core. The worker pool can be
+// resized at runtime, or tuned automatically against callback latency and errors.
+// In partitioned mode, messages are hashed by key onto ordered lanes.
 package nats
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"sync"
 	"time"
@@ -21,23 +25,28 @@ import (
 //
 // Processing model:
 //
-//	1. Acquire semaphore slot  (blocks when at max concurrency)
-//	2. Fetch one message       (only pulls when capacity exists)
-//	3. Spawn goroutine         (runs callback, releases semaphore)
-//	4. Repeat
+//  1. Acquire worker slot     (blocks when at max concurrency)
+//  2. Fetch one message       (only pulls when capacity exists)
+//  3. Spawn goroutine         (runs callback, releases semaphore)
+//  4. Repeat
 //
 // This ensures:
 //   - At most MaxWorkers callbacks execute concurrently
 //   - Fetch is paced to callback completion rate (natural backpressure)
 //   - Messages are only pulled when a worker slot is available
-//   - ACK/NAK is the callback's responsibility
+//   - ACK/NAK is the callback's responsibility; callbacks returning without an ACK count as failed
 type ConcurrentRoute struct {
 	route     *Route
 	sub       *natslib.Subscription
-	sem       chan struct{}    // semaphore: capacity = max workers
-	wg        sync.WaitGroup  // tracks in-flight goroutines
-	batchSize int             // messages to fetch per pull (from config or default)
+	workers   *workerLimiter     // semaphore: limit = max workers, resizable
+	metrics   *concurrentMetrics // dispatch and processing metrics
+	wg        sync.WaitGroup     // tracks in-flight goroutines
+	batchSize int                // messages to fetch per pull (from config or default)
 	callback  func(ctx context.Context, msg routing.MessageEnvelop)
+	partition func(msg routing.MessageEnvelop) string // partition key, nil unless partitioned
+	lanes     []chan laneItem                         // ordered lanes of a partitioned route
+	stop      context.CancelFunc                      // stops the consume loop
+	done      chan struct{}                           // closed once the consume loop exited
 }
 
 // NewConcurrentRouteSubscriber creates a concurrent route subscriber.
@@ -55,6 +64,47 @@ func NewConcurrentRouteSubscriber(
 	callback func(ctx context.Context, msg routing.MessageEnvelop),
 	opts ...RouteOption,
 ) (*ConcurrentRoute, error) {
+	return newConcurrentRouteSubscriber(ctx, selector, maxWorkers, 0, nil, callback, opts...)
+}
+
+// NewPartitionedRouteSubscriber creates a concurrent route subscriber in
+// partitioned mode: each message is hashed by its key onto one of partitions
+// ordered lanes, so messages with the same key are processed one at a time in
+// delivery order while different keys are processed concurrently. Use
+// routing.HeaderKey or routing.FieldKey, e.g. routing.FieldKey("route_id") for
+// models.RouteMessage, as key. The key is computed in the fetch loop, so prefer
+// routing.HeaderKey: routing.FieldKey decodes every message, downloading claim
+// checked payloads, before it can be dispatched.
+//
+// A lane moves to its next message once the callback returned, so acks are
+// committed in order per lane. Messages the callback does not ACK are
+// redelivered after the ones that followed them. A message fetched for a full
+// lane waits for room, holding up the fetch of further messages until its lane
+// drains, so the order of a key holds even when its lane is slow. The worker
+// pool, sized to partitions, still bounds how many lanes run callbacks at once.
+func NewPartitionedRouteSubscriber(
+	ctx context.Context,
+	selector string,
+	partitions int,
+	key func(msg routing.MessageEnvelop) string,
+	callback func(ctx context.Context, msg routing.MessageEnvelop),
+	opts ...RouteOption,
+) (*ConcurrentRoute, error) {
+	if partitions < 1 || key == nil {
+		return nil, fmt.Errorf("partitioned route requires a key and at least one partition")
+	}
+	return newConcurrentRouteSubscriber(ctx, selector, partitions, partitions, key, callback, opts...)
+}
+
+func newConcurrentRouteSubscriber(
+	ctx context.Context,
+	selector string,
+	maxWorkers int,
+	partitions int,
+	key func(msg routing.MessageEnvelop) string,
+	callback func(ctx context.Context, msg routing.MessageEnvelop),
+	opts ...RouteOption,
+) (*ConcurrentRoute, error) {
 
 	// Create and connect the underlying route (loads config, connects, creates stream).
 	route, err := NewRouteUsingSelector(ctx, selector, opts...)
@@ -73,9 +123,14 @@ func NewConcurrentRouteSubscriber(
 
 	cr := &ConcurrentRoute{
 		route:     route,
-		sem:       make(chan struct{}, maxWorkers),
+		workers:   newWorkerLimiter(maxWorkers),
+		metrics:   newConcurrentMetrics(),
 		batchSize: batchSize,
 		callback:  callback,
+		partition: key,
+	}
+	for range partitions {
+		cr.lanes = append(cr.lanes, make(chan laneItem, batchSize))
 	}
 
 	// Resolve consumer configuration from the route config.
@@ -107,11 +162,16 @@ func NewConcurrentRouteSubscriber(
 		return nil, fmt.Errorf("pull subscribe on stream %s: %w", streamName, err)
 	}
 
+	// Dead-letter messages the server stops redelivering once max_deliver is reached.
+	if route.dlqSub, err = route.watchMaxDeliveries(streamName, durableName); err != nil {
+		return nil, fmt.Errorf("watch max deliveries on stream %s: %w", streamName, err)
+	}
+
 	// Start the concurrent consume loop.
 	cr.startConsumeLoop(ctx)
 
-	log.Printf("[concurrent] started: selector=%s, stream=%s, consumer=%s, workers=%d, batch=%d",
-		selector, streamName, durableName, maxWorkers, batchSize)
+	log.Printf("[concurrent] started: selector=%s, stream=%s, consumer=%s, workers=%d, partitions=%d, batch=%d",
+		selector, streamName, durableName, maxWorkers, partitions, batchSize)
 
 	return cr, nil
 }
@@ -141,6 +201,12 @@ func (cr *ConcurrentRoute) ensureConsumer(stream, consumer string) error {
 	if cr.route.Config.MaxAckPending != nil {
 		cfg.MaxAckPending = *cr.route.Config.MaxAckPending
 	}
+	if cr.route.Config.MaxDeliver != nil {
+		cfg.MaxDeliver = *cr.route.Config.MaxDeliver
+	}
+	if backoff := cr.route.Config.BackoffDurations(); backoff != nil {
+		cfg.BackOff = backoff
+	}
 
 	_, err = cr.route.js.AddConsumer(stream, cfg)
 	if err != nil {
@@ -158,24 +224,43 @@ func (cr *ConcurrentRoute) ensureConsumer(stream, consumer string) error {
 //
 //	msgs := sub.Fetch(batchSize)   // pull up to batchSize messages
 //	for each msg:
-//	  sem <- struct{}{}            // acquire slot (blocks at capacity)
+//	  workers.acquire()            // acquire slot (blocks at capacity)
 //	  go callback(msg)             // process in goroutine
-//	    defer <-sem                // release slot when done
+//	    defer workers.release()    // release slot when done
 func (cr *ConcurrentRoute) startConsumeLoop(ctx context.Context) {
+	// The loop is stopped by Shutdown, while worker callbacks keep ctx.
+	loopCtx, stop := context.WithCancel(ctx)
+	cr.stop, cr.done = stop, make(chan struct{})
+
+	// Lanes process what was handed to them, and exit once the loop closed them.
+	for _, lane := range cr.lanes {
+		cr.wg.Add(1)
+		go cr.runLane(ctx, lane)
+	}
+
 	go func() {
+		defer close(cr.done)
+		defer stop()
+		defer func() {
+			for _, lane := range cr.lanes {
+				close(lane)
+			}
+		}()
 		for {
 			// Check for shutdown.
 			select {
-			case <-ctx.Done():
-				log.Printf("[concurrent] consume loop stopped: %v", ctx.Err())
+			case <-loopCtx.Done():
+				log.Printf("[concurrent] consume loop stopped: %v", loopCtx.Err())
 				return
 			default:
 			}
 
-			// Fetch a batch of messages. MaxWait prevents busy-spinning when idle.
-			msgs, err := cr.sub.Fetch(cr.batchSize, natslib.MaxWait(5*time.Second))
+			// Fetch a batch of messages. The fetch wait prevents busy-spinning when idle.
+			fetchCtx, cancel := context.WithTimeout(loopCtx, pullFetchWait)
+			msgs, err := cr.sub.Fetch(cr.batchSize, natslib.Context(fetchCtx))
+			cancel()
 			if err != nil {
-				if err == natslib.ErrTimeout {
+				if errors.Is(err, natslib.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) || loopCtx.Err() != nil {
 					continue
 				}
 				// Fatal subscription errors — subscription is dead, stop the loop.
@@ -189,44 +274,205 @@ func (cr *ConcurrentRoute) startConsumeLoop(ctx context.Context) {
 				continue
 			}
 
-			// Dispatch each message to a worker goroutine.
-			for _, msg := range msgs {
-				// Acquire semaphore slot. Blocks when all workers are busy,
-				// which naturally throttles dispatch to processing rate.
-				cr.sem <- struct{}{}
-
+			// Dispatch each message to a worker goroutine, or to its lane when partitioned.
+			fetched := time.Now()
+			for i, msg := range msgs {
 				// Log redeliveries for debugging ACK issues.
+				redelivered := false
 				if meta, metaErr := msg.Metadata(); metaErr == nil && meta.NumDelivered > 1 {
+					redelivered = true
 					log.Printf("[concurrent] redelivery #%d: subject=%s, stream_seq=%d",
 						meta.NumDelivered, msg.Subject, meta.Sequence.Stream)
 				}
 
+				// On shutdown, the remaining messages are released for redelivery.
+				if cr.lanes != nil {
+					item := laneItem{envelop: newMessageEnvelop(ctx, msg, cr.route), fetched: fetched, redelivered: redelivered}
+					if err := cr.dispatchToLane(loopCtx, item); err != nil {
+						nakUndispatched(msgs[i:])
+						return
+					}
+					continue
+				}
+
+				// Acquire worker slot. Blocks when all workers are busy,
+				// which naturally throttles dispatch to processing rate.
+				throttled, err := cr.workers.acquire(loopCtx)
+				if err != nil {
+					nakUndispatched(msgs[i:])
+					return
+				}
+				cr.metrics.dispatched(time.Since(fetched), throttled, redelivered)
+
 				// Spawn goroutine to process the message.
-				// The goroutine owns the semaphore slot and releases it when done.
+				// The goroutine owns the worker slot and releases it when done.
 				cr.wg.Add(1)
 				go func(m *natslib.Msg) {
 					defer cr.wg.Done()
-					defer func() { <-cr.sem }()
-
-					envelop := &MessageEnvelop{Msg: m}
-					cr.callback(ctx, envelop)
+					defer cr.workers.release()
+					cr.process(ctx, newMessageEnvelop(ctx, m, cr.route))
 				}(msg)
 			}
 		}
 	}()
 }
 
-// Stop gracefully shuts down the concurrent route.
-// Waits for all in-flight goroutines to finish processing before draining.
-func (cr *ConcurrentRoute) Stop() error {
+// laneItem is a message handed to a lane of a partitioned route. Its envelope is the one the
+// partition key was computed on, so a payload decoded for the key is not fetched again.
+type laneItem struct {
+	envelop     *MessageEnvelop
+	fetched     time.Time
+	redelivered bool
+}
+
+// process runs the callback for a message and records its outcome.
+func (cr *ConcurrentRoute) process(ctx context.Context, envelop *MessageEnvelop) {
+	started := time.Now()
+	cr.callback(ctx, envelop)
+	cr.metrics.completed(time.Since(started), !envelop.acked.Load())
+}
+
+// laneOf returns the lane of a message, hashing its partition key.
+func (cr *ConcurrentRoute) laneOf(envelop *MessageEnvelop) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(cr.partition(envelop)))
+	return int(h.Sum32() % uint32(len(cr.lanes)))
+}
+
+// dispatchToLane hands item to the lane of its key. When the lane is full, it blocks the fetch
+// loop until the lane has room or ctx is done; rejecting the message instead would let the
+// messages following it on its key overtake it.
+func (cr *ConcurrentRoute) dispatchToLane(ctx context.Context, item laneItem) error {
+	select {
+	case cr.lanes[cr.laneOf(item.envelop)] <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runLane processes the messages of a lane one at a time, each holding a worker slot, until the
+// lane is closed. Messages left once ctx is done are released for redelivery.
+func (cr *ConcurrentRoute) runLane(ctx context.Context, lane <-chan laneItem) {
+	defer cr.wg.Done()
+	for item := range lane {
+		throttled, err := cr.workers.acquire(ctx)
+		if err != nil {
+			nakUndispatched([]*natslib.Msg{item.envelop.Msg})
+			continue
+		}
+		cr.metrics.dispatched(time.Since(item.fetched), throttled, item.redelivered)
+		cr.process(ctx, item.envelop)
+		cr.workers.release()
+	}
+}
+
+// SetMaxWorkers resizes the worker pool. When shrinking, in-flight callbacks finish and no
+// new ones start until fewer than n are executing.
+func (cr *ConcurrentRoute) SetMaxWorkers(n int) {
+	cr.workers.resize(n)
+}
+
+// MaxWorkers returns the current size of the worker pool.
+func (cr *ConcurrentRoute) MaxWorkers() int {
+	limit, _ := cr.workers.stats()
+	return limit
+}
+
+// Metrics returns a snapshot of the route metrics since it started.
+func (cr *ConcurrentRoute) Metrics() ConcurrentMetrics {
+	metrics := cr.metrics.snapshot()
+	metrics.MaxWorkers, metrics.InFlight = cr.workers.stats()
+	return metrics
+}
+
+// AutoTune resizes the worker pool every config interval, AIMD style, until ctx is done or the
+// route is shut down: it backs off multiplicatively when callbacks are slow or failing and adds
+// a worker when messages waited for one. Partitioned routes are tuned within their partition
+// count, see AutoTuneConfig.
+func (cr *ConcurrentRoute) AutoTune(ctx context.Context, config AutoTuneConfig) {
+	config = config.withDefaults(cr.MaxWorkers())
+	if cr.lanes != nil {
+		// workers above the lane count would never run a callback
+		config.MaxWorkers = max(min(config.MaxWorkers, len(cr.lanes)), config.MinWorkers)
+	}
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+
+		prev := cr.Metrics()
+		for {
+			select {
+			case <-ticker.C:
+			case <-cr.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+
+			current := cr.Metrics()
+			window := current.delta(prev)
+			prev = current
+
+			if workers := config.next(current.MaxWorkers, window); workers != current.MaxWorkers {
+				log.Printf("[concurrent] auto-tune: workers %d -> %d (processed=%d, failed=%d, mean latency=%s, throttled=%d)",
+					current.MaxWorkers, workers, window.Processed, window.Failed, window.Latency.Mean(), window.Throttled)
+				cr.SetMaxWorkers(workers)
+			}
+		}
+	}()
+}
+
+// Shutdown stops the concurrent route gracefully: it stops fetching, NAKs fetched messages
+// that were not dispatched, waits until ctx is done for in-flight workers to finish and
+// then drains the subscription and the route.
+func (cr *ConcurrentRoute) Shutdown(ctx context.Context) error {
 	log.Printf("[concurrent] stopping, waiting for in-flight messages...")
-	cr.wg.Wait()
-	log.Printf("[concurrent] all in-flight messages processed")
+
+	// Once the loop exited no further workers are started.
+	var err error
+	if cr.stop != nil {
+		cr.stop()
+		select {
+		case <-cr.done:
+		case <-ctx.Done():
+			err = fmt.Errorf("timed out waiting for consume loop: %w", ctx.Err())
+		}
+	}
+
+	if err == nil {
+		workers := make(chan struct{})
+		go func() {
+			cr.wg.Wait()
+			close(workers)
+		}()
+		select {
+		case <-workers:
+			log.Printf("[concurrent] all in-flight messages processed")
+		case <-ctx.Done():
+			err = fmt.Errorf("timed out waiting for in-flight messages: %w", ctx.Err())
+		}
+	}
+	if err != nil {
+		log.Printf("[concurrent] %v", err)
+	}
+
+	if cr.sub != nil && cr.sub.IsValid() {
+		if drainErr := cr.sub.Drain(); drainErr != nil {
+			log.Printf("[concurrent] failed to drain subscription: %v", drainErr)
+		}
+	}
 
 	if cr.route != nil {
-		return cr.route.Drain()
+		return errors.Join(err, cr.route.Shutdown(ctx))
 	}
-	return nil
+	return err
+}
+
+// Stop gracefully shuts down the concurrent route.
+// Waits for all in-flight goroutines to finish processing before draining.
+func (cr *ConcurrentRoute) Stop() error {
+	return cr.Shutdown(context.Background())
 }
 
 // Drain is an alias for Stop (satisfies common shutdown patterns).
@@ -0,0 +1,141 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	natslib "github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+)
+
+func TestConcurrentRoute_PartitionedLanes(t *testing.T) {
+	ctx := t.Context()
+
+	var mu sync.Mutex
+	handled := map[string][]int{}
+	cr := &ConcurrentRoute{
+		workers:   newWorkerLimiter(4),
+		metrics:   newConcurrentMetrics(),
+		partition: routing.FieldKey("route_id"),
+		callback: func(ctx context.Context, msg routing.MessageEnvelop) {
+			var payload struct {
+				RouteID string `json:"route_id"`
+				Seq     int    `json:"seq"`
+			}
+			if err := msg.Decode(&payload); err != nil {
+				t.Errorf("failed to decode message: %v", err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			handled[payload.RouteID] = append(handled[payload.RouteID], payload.Seq)
+		},
+	}
+	for range 4 {
+		cr.lanes = append(cr.lanes, make(chan laneItem, 8))
+	}
+
+	msgOf := func(routeID string, seq int) *MessageEnvelop {
+		msg := &natslib.Msg{Subject: "test.partitioned", Data: fmt.Appendf(nil, `{"route_id":%q,"seq":%d}`, routeID, seq)}
+		return newMessageEnvelop(ctx, msg, nil)
+	}
+	if cr.laneOf(msgOf("route-a", 1)) != cr.laneOf(msgOf("route-a", 2)) {
+		t.Fatal("expected messages with the same key on the same lane")
+	}
+
+	for _, lane := range cr.lanes {
+		cr.wg.Add(1)
+		go cr.runLane(ctx, lane)
+	}
+	for seq := range 40 {
+		msg := msgOf(fmt.Sprintf("route-%d", seq%5), seq)
+		cr.lanes[cr.laneOf(msg)] <- laneItem{envelop: msg, fetched: time.Now()}
+	}
+	for _, lane := range cr.lanes {
+		close(lane)
+	}
+	cr.wg.Wait()
+
+	if len(handled) != 5 {
+		t.Fatalf("expected messages of 5 routes, got %d", len(handled))
+	}
+	for routeID, seqs := range handled {
+		if len(seqs) != 8 {
+			t.Errorf("expected 8 messages for %s, got %d", routeID, len(seqs))
+		}
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i-1] > seqs[i] {
+				t.Errorf("messages of %s processed out of order: %v", routeID, seqs)
+				break
+			}
+		}
+	}
+	if metrics := cr.Metrics(); metrics.Processed != 40 || metrics.InFlight != 0 {
+		t.Errorf("expected 40 processed messages and none in flight, got %+v", metrics)
+	}
+}
+
+func TestConcurrentRoute_LaneOverflow(t *testing.T) {
+	ctx := t.Context()
+
+	var mu sync.Mutex
+	var handled []int
+	cr := &ConcurrentRoute{
+		workers:   newWorkerLimiter(2),
+		metrics:   newConcurrentMetrics(),
+		partition: routing.HeaderKey("key"),
+		lanes:     []chan laneItem{make(chan laneItem, 1)},
+		callback: func(ctx context.Context, msg routing.MessageEnvelop) {
+			seq, _ := strconv.Atoi(msg.Headers().Get("seq"))
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, seq)
+		},
+	}
+
+	msgOf := func(seq int) *MessageEnvelop {
+		msg := natslib.NewMsg("test.partitioned")
+		msg.Header.Set("key", "a")
+		msg.Header.Set("seq", strconv.Itoa(seq))
+		return newMessageEnvelop(ctx, msg, nil)
+	}
+
+	cr.wg.Add(1)
+	go cr.runLane(ctx, cr.lanes[0])
+
+	// the lane holds one message, the others wait for room instead of being redelivered later
+	for seq := range 10 {
+		if err := cr.dispatchToLane(ctx, laneItem{envelop: msgOf(seq), fetched: time.Now()}); err != nil {
+			t.Fatalf("dispatchToLane() error = %v", err)
+		}
+	}
+	close(cr.lanes[0])
+	cr.wg.Wait()
+
+	if len(handled) != 10 {
+		t.Fatalf("expected 10 handled messages, got %v", handled)
+	}
+	for i, seq := range handled {
+		if seq != i {
+			t.Fatalf("messages processed out of order: %v", handled)
+		}
+	}
+
+	// a dispatch waiting on a full lane gives up once the fetch loop stops
+	full := &ConcurrentRoute{partition: routing.HeaderKey("key"), lanes: []chan laneItem{make(chan laneItem, 1)}}
+	if err := full.dispatchToLane(ctx, laneItem{envelop: msgOf(0)}); err != nil {
+		t.Fatalf("dispatchToLane() error = %v", err)
+	}
+	stopped, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := full.dispatchToLane(stopped, laneItem{envelop: msgOf(1)}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("dispatchToLane() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -88,3 +88,40 @@ func TestRoute_Subscribe(t *testing.T) {
 	time.Sleep(1 * time.Second)
 	require.True(t, updated)
 }
+
+func TestRoute_SharedConnection(t *testing.T) {
+	ctx := t.Context()
+	manager := NewConnectionManager()
+
+	routeA := NewRoute(&NatConfig{Selector: "test/shared/a", Subject: "test.shared.a", URL: "nats://localhost:4222"}, nil, WithConnectionManager(manager))
+	routeB := NewRoute(&NatConfig{Selector: "test/shared/b", Subject: "test.shared.b", URL: "nats://localhost:4222"}, nil, WithConnectionManager(manager))
+	require.NoError(t, routeA.Connect(ctx))
+	require.NoError(t, routeB.Connect(ctx))
+	require.Same(t, routeA.nc, routeB.nc)
+	require.Equal(t, 1, manager.Len())
+
+	// draining one route must leave the shared connection open for the other
+	require.NoError(t, routeA.Drain())
+	require.False(t, routeA.IsConnected())
+	require.True(t, routeB.IsConnected())
+	require.NoError(t, routeB.Publish(ctx, "still connected"))
+
+	require.NoError(t, routeB.Disconnect(ctx))
+	require.Equal(t, 0, manager.Len())
+}
+
+func TestRoute_ReconfigureReleasesConnection(t *testing.T) {
+	ctx := t.Context()
+	manager := NewConnectionManager()
+
+	route := NewRoute(&NatConfig{Selector: "test/shared/a", Subject: "test.shared.a", URL: "nats://localhost:4222"}, nil, WithConnectionManager(manager))
+	require.NoError(t, route.Connect(ctx))
+	require.Equal(t, 1, manager.Len())
+
+	// a different URL needs another connection, the previous one must be released
+	require.NoError(t, route.Reconfigure(ctx, &NatConfig{Selector: "test/shared/a", Subject: "test.shared.a", URL: "nats://127.0.0.1:4222"}))
+	require.Equal(t, 1, manager.Len())
+
+	require.NoError(t, route.Disconnect(ctx))
+	require.Equal(t, 0, manager.Len())
+}
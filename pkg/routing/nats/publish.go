@@ -0,0 +1,152 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/utils"
+)
+
+// publishJetStream publishes msg to the route stream and verifies the publish acknowledgement,
+// retrying unacknowledged publishes as configured by options. Publishes carrying a message ID
+// are deduplicated by the stream, so retrying them cannot store the message twice.
+func (r *Route) publishJetStream(ctx context.Context, msg *nats.Msg, options *routing.PublishOptions) (*nats.PubAck, error) {
+	var pubOpts []nats.PubOpt
+	if _, ok := ctx.Deadline(); ok {
+		pubOpts = append(pubOpts, nats.Context(ctx))
+	}
+
+	attempts := max(options.RetryAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		ack, err := r.js.PublishMsg(msg, pubOpts...)
+		if err == nil {
+			if err = r.verifyAck(ack); err != nil {
+				return nil, err // acknowledged by the wrong stream, retrying will not help
+			}
+			if ack.Duplicate {
+				log.Printf("duplicate publish dropped by JetStream: stream=%s seq=%d msg_id=%s",
+					ack.Stream, ack.Sequence, msg.Header.Get(routing.HeaderMsgID))
+			}
+			return ack, nil
+		}
+
+		if attempt >= attempts || ctx.Err() != nil {
+			return nil, err
+		}
+
+		log.Printf("publish to %s not acknowledged (attempt %d/%d), retrying: %v", msg.Subject, attempt, attempts, err)
+		select {
+		case <-time.After(options.RetryWait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// verifyAck checks that the publish was stored by the route stream.
+func (r *Route) verifyAck(ack *nats.PubAck) error {
+	if ack == nil {
+		return fmt.Errorf("missing publish acknowledgement: %w", nats.ErrInvalidJSAck)
+	}
+	if r.Config.Name != nil && ack.Stream != *r.Config.Name {
+		return fmt.Errorf("publish acknowledged by stream %s, expected %s", ack.Stream, *r.Config.Name)
+	}
+	return nil
+}
+
+const (
+	// defaultMaxPublishPending bounds the async publishes of a route awaiting acknowledgement.
+	defaultMaxPublishPending = 256
+
+	// asyncErrorsBuffer is the capacity of the async publish error channel.
+	asyncErrorsBuffer = 64
+)
+
+var (
+	asyncAckTimeout = utils.DurationFromEnvWithDefault("NATS_ASYNC_ACK_TIMEOUT", 5*time.Second)
+)
+
+func (r *Route) initAsync() {
+	r.asyncOnce.Do(func() {
+		pending := defaultMaxPublishPending
+		if r.Config.MaxPublishPending != nil && *r.Config.MaxPublishPending > 0 {
+			pending = *r.Config.MaxPublishPending
+		}
+		r.asyncSlots = make(chan struct{}, pending)
+		r.asyncErrs = make(chan error, asyncErrorsBuffer)
+	})
+}
+
+// PublishAsync publishes msg to the subject without waiting for the JetStream acknowledgement,
+// blocking while max_publish_pending publishes are awaiting theirs. Core NATS publishes have no
+// acknowledgement and complete immediately.
+func (r *Route) PublishAsync(ctx context.Context, msg any, opts ...routing.PublishOption) (*routing.PublishFuture, error) {
+	natsMsg, _, err := r.newMsg(ctx, r.Config.Subject, msg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	if err := r.Connect(ctx); err != nil {
+		return nil, err
+	}
+	r.initAsync()
+
+	future := routing.NewPublishFuture()
+	if !r.Config.JetStreamEnabled() {
+		if err := r.nc.PublishMsg(natsMsg); err != nil {
+			return nil, fmt.Errorf("failed to publish message: %w", err)
+		}
+		future.Complete(nil)
+		return future, nil
+	}
+
+	select {
+	case r.asyncSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	ackFuture, err := r.js.PublishMsgAsync(natsMsg)
+	if err != nil {
+		<-r.asyncSlots
+		return nil, fmt.Errorf("failed to publish message to JetStream: %w", err)
+	}
+
+	go r.awaitAck(natsMsg, ackFuture, future)
+	return future, nil
+}
+
+// AsyncErrors returns a channel receiving an *routing.AsyncPublishError for every failed
+// async publish. Errors are logged and dropped when the channel is full.
+func (r *Route) AsyncErrors() <-chan error {
+	r.initAsync()
+	return r.asyncErrs
+}
+
+// awaitAck completes future with the acknowledgement of an async publish.
+func (r *Route) awaitAck(msg *nats.Msg, ackFuture nats.PubAckFuture, future *routing.PublishFuture) {
+	var err error
+	select {
+	case ack := <-ackFuture.Ok():
+		err = r.verifyAck(ack)
+	case err = <-ackFuture.Err():
+	case <-time.After(asyncAckTimeout):
+		err = nats.ErrTimeout
+	}
+	<-r.asyncSlots
+
+	if err != nil {
+		asyncErr := &routing.AsyncPublishError{Subject: msg.Subject, MsgID: msg.Header.Get(routing.HeaderMsgID), Err: err}
+		select {
+		case r.asyncErrs <- asyncErr:
+		default:
+			log.Printf("%v", asyncErr)
+		}
+		err = asyncErr
+	}
+	future.Complete(err)
+}
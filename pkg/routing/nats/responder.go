@@ -0,0 +1,103 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+)
+
+// NewResponderRoute returns a route serving requests with responder once subscribed. The config
+// must use mode "request-reply"; set a queue to load balance requests across responder instances.
+func NewResponderRoute(config *NatConfig, responder routing.Responder, opts ...RouteOption) *Route {
+	route := NewRoute(config, nil, opts...)
+	route.Responder = responder
+	return route
+}
+
+// subscribeResponder subscribes to requests on the subject, joining the queue group if one is
+// configured, and replies with the result of the route responder.
+func (r *Route) subscribeResponder(ctx context.Context) error {
+	if r.Responder == nil {
+		return errors.New("request-reply mode requires a responder")
+	}
+
+	encoding, err := r.Config.Encoding()
+	if err != nil {
+		return err
+	}
+	timeout := r.Config.RequestTimeoutDuration()
+	responderID := uuid.NewString() // identifies this responder in scatter-gather replies
+
+	handler := func(msg *nats.Msg) {
+		if msg.Reply == "" {
+			log.Printf("dropping message without reply subject on request-reply subject: %s", msg.Subject)
+			return
+		}
+
+		envelop := newMessageEnvelop(ctx, msg, r)
+		data, header := routing.HandleRequest(ctx, r.Responder, envelop, encoding, timeout)
+		header.Set(routing.HeaderResponderID, responderID)
+		if err := msg.RespondMsg(&nats.Msg{Data: data, Header: nats.Header(header)}); err != nil {
+			log.Printf("failed to reply to request on subject %s: %v", msg.Subject, err)
+		}
+	}
+
+	if r.Config.Queue != nil {
+		log.Printf("Serving requests on subject: %s (queue: %s)", r.Config.Subject, *r.Config.Queue)
+		r.sub, err = r.nc.QueueSubscribe(r.Config.Subject, *r.Config.Queue, handler)
+	} else {
+		log.Printf("Serving requests on subject: %s", r.Config.Subject)
+		r.sub, err = r.nc.Subscribe(r.Config.Subject, handler)
+	}
+	return err
+}
+
+// ScatterGather publishes msg as a request to every responder on the subject and streams their
+// replies until the gather target is reached, there are no responders, or ctx is done. Without a
+// context deadline, replies are gathered for the route request timeout.
+func (r *Route) ScatterGather(ctx context.Context, msg any, gather routing.GatherOptions, opts ...routing.PublishOption) (<-chan *routing.Reply, error) {
+	natsMsg, _, err := r.newMsg(ctx, r.Config.Subject, msg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	if err := r.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok {
+		ctx, cancel = context.WithTimeout(ctx, r.Config.RequestTimeoutDuration())
+	}
+
+	msgs := make(chan *nats.Msg)
+	done := make(chan struct{})
+	sub, err := r.nc.Subscribe(r.nc.NewInbox(), func(reply *nats.Msg) {
+		select {
+		case msgs <- reply:
+		case <-done:
+		}
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to subscribe to reply inbox: %w", err)
+	}
+	stop := func() {
+		close(done)
+		_ = sub.Unsubscribe()
+		cancel()
+	}
+
+	natsMsg.Reply = sub.Subject
+	if err := r.nc.PublishMsg(natsMsg); err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to publish request: %w", err)
+	}
+
+	return routing.GatherReplies(ctx, gather, msgs, stop), nil
+}
@@ -1,25 +1,61 @@
 package nats
 
 import (
-	"errors"
 	"fmt"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
 	"github.com/quantumwake/alethic-ism-core-go/pkg/utils"
-	"gopkg.in/yaml.v3"
 	"log"
-	"os"
+	"strings"
+	"time"
 )
 
+// MemoryURLScheme is the URL scheme that selects the in-process broker
+// (see package routing/memory) instead of a NATS server, e.g. "memory://local".
+const MemoryURLScheme = "memory://"
+
 type NatConfig struct {
-	Selector      string  `yaml:"selector"`
-	Name          *string `yaml:"name,omitempty"`            // Optional field
-	Queue         *string `yaml:"queue,omitempty"`           // Optional field
-	Subject       string  `yaml:"subject"`
-	URL           string  `yaml:"url"`
-	MaxAckPending *int    `yaml:"max_ack_pending,omitempty"` // Optional: JetStream max unacked messages
-	AckWait       *int    `yaml:"ack_wait,omitempty"`        // Optional: JetStream ack wait in seconds
-	Mode          *string `yaml:"mode,omitempty"`            // Optional: "push" (default), "pull", "request-reply"
-	BatchSize     *int    `yaml:"batch_size,omitempty"`      // Optional: Batch size for pull mode (default 10)
-	Mirror        *string `yaml:"mirror,omitempty"`          // Optional: source stream name to mirror
+	Selector      string  `yaml:"selector" json:"selector"`
+	Name          *string `yaml:"name,omitempty" json:"name,omitempty"`   // Optional field
+	Queue         *string `yaml:"queue,omitempty" json:"queue,omitempty"` // Optional field
+	Subject       string  `yaml:"subject" json:"subject"`
+	URL           string  `yaml:"url" json:"url"`
+	MaxAckPending *int    `yaml:"max_ack_pending,omitempty" json:"max_ack_pending,omitempty"` // Optional: JetStream max unacked messages
+	AckWait       *int    `yaml:"ack_wait,omitempty" json:"ack_wait,omitempty"`               // Optional: JetStream ack wait in seconds
+	Mode          *string `yaml:"mode,omitempty" json:"mode,omitempty"`                       // Optional: "push" (default), "pull", "request-reply"
+	BatchSize     *int    `yaml:"batch_size,omitempty" json:"batch_size,omitempty"`           // Optional: Batch size for pull mode (default 10)
+	Mirror        *string `yaml:"mirror,omitempty" json:"mirror,omitempty"`                   // Optional: source stream name to mirror
+	Codec         *string `yaml:"codec,omitempty" json:"codec,omitempty"`                     // Optional: "json" (default), "msgpack" or "cbor", with "+gzip"/"+zstd" compression
+
+	Retention       *string `yaml:"retention,omitempty" json:"retention,omitempty"`               // Optional: stream retention "limits" (default), "interest" or "workqueue"
+	Storage         *string `yaml:"storage,omitempty" json:"storage,omitempty"`                   // Optional: stream storage "file" (default) or "memory"
+	Replicas        *int    `yaml:"replicas,omitempty" json:"replicas,omitempty"`                 // Optional: stream replicas (default 1)
+	MaxAge          *int    `yaml:"max_age,omitempty" json:"max_age,omitempty"`                   // Optional: stream max message age in seconds (default unlimited)
+	MaxBytes        *int64  `yaml:"max_bytes,omitempty" json:"max_bytes,omitempty"`               // Optional: stream max size in bytes (default unlimited)
+	Discard         *string `yaml:"discard,omitempty" json:"discard,omitempty"`                   // Optional: discard policy at limits "old" (default) or "new"
+	DuplicateWindow *int    `yaml:"duplicate_window,omitempty" json:"duplicate_window,omitempty"` // Optional: stream duplicate detection window in seconds (default 120)
+
+	MaxPublishPending *int `yaml:"max_publish_pending,omitempty" json:"max_publish_pending,omitempty"` // Optional: max async publishes awaiting acknowledgement (default 256)
+	RequestTimeout    *int `yaml:"request_timeout,omitempty" json:"request_timeout,omitempty"`         // Optional: seconds a responder may take to reply, and a request without deadline waits (default 5)
+
+	MaxDeliver        *int    `yaml:"max_deliver,omitempty" json:"max_deliver,omitempty"`                 // Optional: JetStream max delivery attempts per message
+	Backoff           []int   `yaml:"backoff,omitempty" json:"backoff,omitempty"`                         // Optional: JetStream redelivery backoff schedule in seconds
+	DeadLetterSubject *string `yaml:"dead_letter_subject,omitempty" json:"dead_letter_subject,omitempty"` // Optional: subject receiving messages that exhausted max_deliver
+
+	ClaimCheckThreshold *int    `yaml:"claim_check_threshold,omitempty" json:"claim_check_threshold,omitempty"` // Optional: payloads above this many bytes are published by reference via the claim check store
+	ClaimCheckPrefix    *string `yaml:"claim_check_prefix,omitempty" json:"claim_check_prefix,omitempty"`       // Optional: object key prefix of claim checked payloads
+
+	ConnectionName *string `yaml:"connection_name,omitempty" json:"connection_name,omitempty"` // Optional: client name reported to the server, defaults to the selector
+	Credentials    *string `yaml:"credentials,omitempty" json:"credentials,omitempty"`         // Optional: path to a .creds file (user JWT and NKey seed)
+	NKeySeed       *string `yaml:"nkey_seed,omitempty" json:"nkey_seed,omitempty"`             // Optional: path to an NKey seed file
+	Token          *string `yaml:"token,omitempty" json:"token,omitempty"`                     // Optional: authentication token
+	User           *string `yaml:"user,omitempty" json:"user,omitempty"`                       // Optional: username, used with password
+	Password       *string `yaml:"password,omitempty" json:"password,omitempty"`               // Optional: password, used with user
+	TLSCert        *string `yaml:"tls_cert,omitempty" json:"tls_cert,omitempty"`               // Optional: client certificate file, used with tls_key
+	TLSKey         *string `yaml:"tls_key,omitempty" json:"tls_key,omitempty"`                 // Optional: client private key file, used with tls_cert
+	TLSCA          *string `yaml:"tls_ca,omitempty" json:"tls_ca,omitempty"`                   // Optional: root CA file used to verify the server
+	ConnectTimeout *int    `yaml:"connect_timeout,omitempty" json:"connect_timeout,omitempty"` // Optional: connect timeout in seconds (default 2)
+	ReconnectWait  *int    `yaml:"reconnect_wait,omitempty" json:"reconnect_wait,omitempty"`   // Optional: wait between reconnect attempts in seconds (default 2)
+	MaxReconnects  *int    `yaml:"max_reconnects,omitempty" json:"max_reconnects,omitempty"`   // Optional: reconnect attempts before giving up, -1 for unlimited (default 60)
 }
 
 func (r *NatConfig) String() string {
@@ -29,6 +65,65 @@ func (r *NatConfig) String() string {
 	return fmt.Sprintf("selector: %s, name: %v, queue: %v, subject: %s, url: %s", r.Selector, r.Name, r.Queue, r.Subject, r.URL)
 }
 
+// InMemory returns true if the route is served by the in-process broker rather than a NATS server.
+func (r *NatConfig) InMemory() bool {
+	return strings.HasPrefix(r.URL, MemoryURLScheme)
+}
+
+// Encoding returns the payload encoding configured by the codec setting, JSON by default.
+func (r *NatConfig) Encoding() (*routing.Encoding, error) {
+	if r.Codec == nil {
+		return routing.DefaultEncoding, nil
+	}
+	return routing.ParseEncoding(*r.Codec)
+}
+
+// ClaimCheck returns the claim check settings of the route, or nil if claim checking is not enabled.
+func (r *NatConfig) ClaimCheck() *routing.ClaimCheck {
+	if r.ClaimCheckThreshold == nil || *r.ClaimCheckThreshold <= 0 {
+		return nil
+	}
+
+	prefix := routing.DefaultClaimCheckPrefix
+	if r.ClaimCheckPrefix != nil {
+		prefix = *r.ClaimCheckPrefix
+	}
+	return &routing.ClaimCheck{Threshold: *r.ClaimCheckThreshold, Prefix: prefix}
+}
+
+// DefaultRequestTimeout bounds requests and responders when request_timeout is not set.
+const DefaultRequestTimeout = 5 * time.Second
+
+// RequestTimeoutDuration returns how long a request waits for its reply, and a responder may take to reply.
+func (r *NatConfig) RequestTimeoutDuration() time.Duration {
+	if r.RequestTimeout == nil || *r.RequestTimeout <= 0 {
+		return DefaultRequestTimeout
+	}
+	return time.Duration(*r.RequestTimeout) * time.Second
+}
+
+// BackoffDurations returns the redelivery backoff schedule, or nil if none is configured.
+func (r *NatConfig) BackoffDurations() []time.Duration {
+	if len(r.Backoff) == 0 {
+		return nil
+	}
+	durations := make([]time.Duration, len(r.Backoff))
+	for i, seconds := range r.Backoff {
+		durations[i] = time.Duration(seconds) * time.Second
+	}
+	return durations
+}
+
+// DeadLetterEnabled returns true if messages exhausting max_deliver are republished to a dead-letter subject.
+func (r *NatConfig) DeadLetterEnabled() bool {
+	return r.DeadLetterSubject != nil && *r.DeadLetterSubject != ""
+}
+
+// DeliveriesExhausted returns true if a message delivered numDelivered times will not be redelivered again.
+func (r *NatConfig) DeliveriesExhausted(numDelivered uint64) bool {
+	return r.MaxDeliver != nil && *r.MaxDeliver > 0 && numDelivered >= uint64(*r.MaxDeliver)
+}
+
 // JetStreamEnabled TODO not necessarily as we can also hook into the nc not js
 // if the queue is set then jetstream is enabled
 func (r *NatConfig) JetStreamEnabled() bool {
@@ -47,47 +142,70 @@ type MessageConfig struct {
 type Config struct {
 	MessageConfig MessageConfig `yaml:"messageConfig"`
 
-	selectorMap map[string]*NatConfig
-	subjectMap  map[string]*NatConfig
+	selectorMap   map[string]*NatConfig
+	subjectMap    map[string]*NatConfig
+	selectorIndex *routeIndex // wildcard selector lookups
+	subjectIndex  *routeIndex // wildcard and suffixed subject lookups
 }
 
-// LoadConfig reads the YAML file and builds hash maps for fast route lookups
-func LoadConfig(configPath string) (*Config, error) {
-	yamlFile, err := os.ReadFile(configPath)
+// LoadConfig reads and validates the YAML file, merged with any overlay files (see mergeOverlay),
+// and builds hash maps for fast route lookups. ${VAR:-default} references are interpolated from
+// the environment.
+func LoadConfig(configPath string, overlayPaths ...string) (*Config, error) {
+	files, err := readConfigFiles(append([]string{configPath}, overlayPaths...))
 	if err != nil {
 		return nil, err
 	}
 
+	// Parse and build the hash maps for quick lookups
+	return parseConfig(files[0], files[1:]...)
+}
+
+// parseConfig parses a YAML routing config, interpolating environment variables and merging
+// overlays, then validates it and builds its route maps.
+func parseConfig(data []byte, overlays ...[]byte) (*Config, error) {
 	var config Config
-	err = yaml.Unmarshal(yamlFile, &config)
-	if err != nil {
+	if err := unmarshalExpandEnv(data, &config); err != nil {
 		return nil, err
 	}
-
-	// Build the hash maps for quick lookups
+	for i, overlay := range overlays {
+		if err := mergeOverlay(&config, overlay); err != nil {
+			return nil, fmt.Errorf("failed to merge routing overlay %d: %w", i+1, err)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid routing config: %w", err)
+	}
 	config.BuildRouteMaps()
-
 	return &config, nil
 }
 
+// LoadConfigFromEnv loads the ROUTING_FILE, merged with the overlays listed in ROUTING_OVERLAYS.
 func LoadConfigFromEnv() (*Config, error) {
 	// load the nats routing table from environment variable
-	config, err := LoadConfig(utils.StringFromEnvWithDefault("ROUTING_FILE", "../routing-nats.yaml"))
+	config, err := LoadConfig(utils.StringFromEnvWithDefault("ROUTING_FILE", "../routing-nats.yaml"), OverlayPathsFromEnv()...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load routing config: %v", err)
 	}
 	return config, nil
 }
 
-// BuildRouteMaps builds hash maps for selector and subject for fast lookups
+// BuildRouteMaps builds hash maps and wildcard indexes for selector and subject for fast lookups
 func (c *Config) BuildRouteMaps() {
 	c.selectorMap = make(map[string]*NatConfig)
 	c.subjectMap = make(map[string]*NatConfig)
+	c.selectorIndex = newRouteIndex(selectorSeparator)
+	c.subjectIndex = newRouteIndex(subjectSeparator)
 
 	for i := range c.MessageConfig.Routes {
 		route := &c.MessageConfig.Routes[i]
 		c.selectorMap[route.Selector] = route
 		c.subjectMap[route.Subject] = route
+		c.selectorIndex.insert(selectorPattern(route.Selector), route, false)
+		if prefix, ok := wildcardPrefix(route.Selector); ok {
+			c.selectorIndex.insertPrefix(prefix, route)
+		}
+		c.subjectIndex.insert(route.Subject, route, true)
 	}
 }
 
@@ -100,43 +218,34 @@ func (c *Config) FindRouteBySelector(selector string) (*NatConfig, error) {
 	return route, nil
 }
 
-// FindRouteBySubject finds a route by its subject using the hash map
+// FindRouteBySubject finds the route of a message subject. Exact matches are looked up in the
+// hash map, otherwise the most specific route subject matching it with NATS wildcards ("*" for
+// one token, ">" for trailing tokens) is returned. A literal route subject also matches the
+// subjects PublishWithSuffix derives from it, as if it were followed by an implicit ".>".
 func (c *Config) FindRouteBySubject(subject string) (*NatConfig, error) {
-	route, found := c.subjectMap[subject]
-	if !found {
-		return nil, errors.New("route not found by subject")
+	if route, found := c.subjectMap[subject]; found {
+		return route, nil
 	}
-	return route, nil
+	if route := c.subjectIndex.match(subject); route != nil {
+		return route, nil
+	}
+	return nil, fmt.Errorf("route not found by subject %s", subject)
 }
 
-// FindRouteBySelectorWildcard finds a route by its selector with wildcard support
-// First attempts exact match, then checks for prefix match with "/*" wildcard suffix
-// Returns error if no match or multiple matches found
+// FindRouteBySelectorWildcard finds a route by its selector with wildcard support.
+// First attempts an exact match, then matches "/" separated selector tokens against
+// route selectors using "*" for a single token and ">" for one or more trailing tokens.
+// If several route selectors match, the most specific one is returned: at each token
+// a literal takes precedence over "*", and "*" over ">". A trailing "/*" matches any
+// depth below its prefix, as well as the bare prefix itself.
 func (c *Config) FindRouteBySelectorWildcard(selector string) (*NatConfig, error) {
 	// Try exact match first
 	if route, found := c.selectorMap[selector]; found {
 		return route, nil
 	}
 
-	// Check for prefix match with /* wildcard
-	var matches []*NatConfig
-	for key, route := range c.selectorMap {
-		if len(key) >= 2 && key[len(key)-2:] == "/*" {
-			prefix := key[:len(key)-2]
-			if len(selector) >= len(prefix) && selector[:len(prefix)] == prefix {
-				matches = append(matches, route)
-			}
-		}
-	}
-
-	// Return if exactly one match found
-	if len(matches) == 1 {
-		return matches[0], nil
-	}
-
-	// Error if multiple matches
-	if len(matches) > 1 {
-		return nil, fmt.Errorf("multiple routes found for wildcard selector %s", selector)
+	if route := c.selectorIndex.match(selector); route != nil {
+		return route, nil
 	}
 
 	// No matches found
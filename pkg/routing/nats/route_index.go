@@ -0,0 +1,162 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Token separators of route subjects and selectors.
+const (
+	subjectSeparator  = "."
+	selectorSeparator = "/"
+)
+
+// routeIndex is a trie resolving subjects or selectors to routes. Route patterns are split
+// into tokens and may use NATS wildcards: "*" matches exactly one token and ">" matches one
+// or more trailing tokens. When several patterns match, the most specific one wins: token by
+// token, a literal beats "*", which beats ">".
+type routeIndex struct {
+	separator string
+	root      *indexNode
+}
+
+type indexNode struct {
+	literals map[string]*indexNode
+	wildcard *indexNode // "*" child
+	tail     *NatConfig // route of a pattern ending in ">" at this node
+	route    *NatConfig // route of a pattern ending at this node
+	suffixed *NatConfig // route of a literal pattern ending at this node, matching names extended by a suffix
+	prefix   *NatConfig // route of a trailing "/*" selector whose prefix ends at this node, matching the bare prefix
+}
+
+func newRouteIndex(separator string) *routeIndex {
+	return &routeIndex{separator: separator, root: &indexNode{}}
+}
+
+// insert adds the route under pattern, replacing any route with the same pattern. If suffixes is
+// set and pattern has no wildcards, names extending pattern by more tokens (such as the subjects
+// of PublishWithSuffix) also match the route, ranked below an explicit pattern + ">".
+func (idx *routeIndex) insert(pattern string, route *NatConfig, suffixes bool) {
+	if pattern == "" {
+		return
+	}
+
+	literal := true
+	node := idx.root
+	for _, token := range strings.Split(pattern, idx.separator) {
+		switch token {
+		case ">":
+			node.tail = route
+			return
+		case "*":
+			literal = false
+			if node.wildcard == nil {
+				node.wildcard = &indexNode{}
+			}
+			node = node.wildcard
+		default:
+			if node.literals == nil {
+				node.literals = make(map[string]*indexNode)
+			}
+			child, found := node.literals[token]
+			if !found {
+				child = &indexNode{}
+				node.literals[token] = child
+			}
+			node = child
+		}
+	}
+
+	node.route = route
+	if suffixes && literal {
+		node.suffixed = route
+	}
+}
+
+// insertPrefix makes the bare prefix of a trailing "/*" selector match route, ranked below a
+// pattern ending at the prefix.
+func (idx *routeIndex) insertPrefix(prefix string, route *NatConfig) {
+	node := idx.root
+	for _, token := range strings.Split(prefix, idx.separator) {
+		var child *indexNode
+		switch token {
+		case "*":
+			if node.wildcard == nil {
+				node.wildcard = &indexNode{}
+			}
+			child = node.wildcard
+		default:
+			if node.literals == nil {
+				node.literals = make(map[string]*indexNode)
+			}
+			if child = node.literals[token]; child == nil {
+				child = &indexNode{}
+				node.literals[token] = child
+			}
+		}
+		node = child
+	}
+	node.prefix = route
+}
+
+// match returns the most specific route matching name, or nil if none does.
+func (idx *routeIndex) match(name string) *NatConfig {
+	if name == "" {
+		return nil
+	}
+	return idx.root.match(strings.Split(name, idx.separator))
+}
+
+func (n *indexNode) match(tokens []string) *NatConfig {
+	if len(tokens) == 0 {
+		if n.route != nil {
+			return n.route
+		}
+		return n.prefix
+	}
+	if child, found := n.literals[tokens[0]]; found {
+		if route := child.match(tokens[1:]); route != nil {
+			return route
+		}
+	}
+	if n.wildcard != nil {
+		if route := n.wildcard.match(tokens[1:]); route != nil {
+			return route
+		}
+	}
+	if n.tail != nil {
+		return n.tail
+	}
+	return n.suffixed
+}
+
+// selectorPattern returns the index pattern of a route selector. A trailing "/*" has always
+// matched every selector below its prefix, at any depth, so it is indexed as "/>".
+func selectorPattern(selector string) string {
+	if prefix, ok := wildcardPrefix(selector); ok {
+		return prefix + selectorSeparator + ">"
+	}
+	return selector
+}
+
+// wildcardPrefix returns the prefix of a trailing "/*" wildcard selector.
+func wildcardPrefix(selector string) (string, bool) {
+	if !strings.HasSuffix(selector, selectorSeparator+"*") {
+		return "", false
+	}
+	return strings.TrimSuffix(selector, selectorSeparator+"*"), true
+}
+
+// validatePattern checks that pattern has no empty tokens and uses ">" only as its last token.
+func validatePattern(pattern, separator string) error {
+	tokens := strings.Split(pattern, separator)
+	for i, token := range tokens {
+		if token == "" {
+			return fmt.Errorf("%s has an empty token", pattern)
+		}
+		if token == ">" && i != len(tokens)-1 {
+			return fmt.Errorf("%s uses > before its last token", pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// StreamConfig returns the JetStream stream configuration of the route, a mirror of the
+// configured source stream or a stream on the route subject.
+func (r *NatConfig) StreamConfig() (*nats.StreamConfig, error) {
+	if r.Name == nil {
+		return nil, errors.New("stream name is not set")
+	}
+
+	cfg := &nats.StreamConfig{Name: *r.Name}
+	if r.Mirror != nil {
+		cfg.Mirror = &nats.StreamSource{Name: *r.Mirror}
+	} else {
+		cfg.Subjects = []string{r.Subject}
+	}
+
+	if err := r.applyStreamSettings(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// StreamDrift is a stream setting that differs from the routing config.
+type StreamDrift struct {
+	Setting   string
+	From, To  any
+	Immutable bool // NATS cannot change the setting of an existing stream, it must be recreated
+}
+
+func (d StreamDrift) String() string {
+	return fmt.Sprintf("%s: %v -> %v", d.Setting, d.From, d.To)
+}
+
+// ReconcileStreamConfig returns current with the stream settings of the route applied, and the
+// settings that differ. Settings not configured on the route are left as is, the route subject is
+// added to the stream subjects unless one of them already captures it, and settings NATS cannot
+// update (storage and mirror) are reported as immutable but left unchanged in the returned config.
+func (r *NatConfig) ReconcileStreamConfig(current *nats.StreamConfig) (*nats.StreamConfig, []StreamDrift, error) {
+	desired := *current
+	if err := r.applyStreamSettings(&desired); err != nil {
+		return nil, nil, err
+	}
+
+	var drifts []StreamDrift
+	diff := func(setting string, from, to any) {
+		if from != to {
+			drifts = append(drifts, StreamDrift{Setting: setting, From: from, To: to})
+		}
+	}
+	diff("retention", current.Retention, desired.Retention)
+	diff("replicas", current.Replicas, desired.Replicas)
+	diff("max_age", current.MaxAge, desired.MaxAge)
+	diff("max_bytes", current.MaxBytes, desired.MaxBytes)
+	diff("discard", current.Discard, desired.Discard)
+	diff("duplicate_window", current.Duplicates, desired.Duplicates)
+
+	if r.Mirror == nil && current.Mirror == nil && !capturesSubject(current.Subjects, r.Subject) {
+		desired.Subjects = append(append([]string(nil), current.Subjects...), r.Subject)
+		drifts = append(drifts, StreamDrift{Setting: "subjects", From: current.Subjects, To: desired.Subjects})
+	}
+
+	immutable := func(setting string, from, to any) {
+		if from != to {
+			drifts = append(drifts, StreamDrift{Setting: setting, From: from, To: to, Immutable: true})
+		}
+	}
+	immutable("storage", current.Storage, desired.Storage)
+	desired.Storage = current.Storage
+	currentMirror, desiredMirror := "", ""
+	if current.Mirror != nil {
+		currentMirror = current.Mirror.Name
+	}
+	if r.Mirror != nil {
+		desiredMirror = *r.Mirror
+	}
+	immutable("mirror", currentMirror, desiredMirror)
+
+	return &desired, drifts, nil
+}
+
+// capturesSubject tells if one of the stream subjects matches subject.
+func capturesSubject(subjects []string, subject string) bool {
+	for _, pattern := range subjects {
+		if pattern == subject || SubjectMatches(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyStreamSettings overwrites cfg with the stream settings configured on the route.
+func (r *NatConfig) applyStreamSettings(cfg *nats.StreamConfig) error {
+	if r.Retention != nil {
+		if err := cfg.Retention.UnmarshalJSON(quote(*r.Retention)); err != nil {
+			return fmt.Errorf("invalid retention %q: %w", *r.Retention, err)
+		}
+	}
+	if r.Storage != nil {
+		if err := cfg.Storage.UnmarshalJSON(quote(*r.Storage)); err != nil {
+			return fmt.Errorf("invalid storage %q: %w", *r.Storage, err)
+		}
+	}
+	if r.Discard != nil {
+		if err := cfg.Discard.UnmarshalJSON(quote(*r.Discard)); err != nil {
+			return fmt.Errorf("invalid discard policy %q: %w", *r.Discard, err)
+		}
+	}
+	if r.Replicas != nil {
+		cfg.Replicas = *r.Replicas
+	}
+	if r.MaxAge != nil {
+		cfg.MaxAge = time.Duration(*r.MaxAge) * time.Second
+	}
+	if r.MaxBytes != nil {
+		cfg.MaxBytes = *r.MaxBytes
+	}
+	if r.DuplicateWindow != nil {
+		cfg.Duplicates = time.Duration(*r.DuplicateWindow) * time.Second
+	}
+	return nil
+}
+
+func quote(s string) []byte {
+	return []byte(strconv.Quote(strings.ToLower(s)))
+}
+
+// ensureStream creates the stream of the route if it does not exist, or updates it if its
+// settings drifted from the routing config.
+func (r *Route) ensureStream() error {
+	desired, err := r.Config.StreamConfig()
+	if err != nil {
+		return err
+	}
+
+	info, err := r.js.StreamInfo(desired.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if desired.Mirror != nil {
+			log.Printf("Creating mirror stream %s from source %s", desired.Name, desired.Mirror.Name)
+		}
+		if _, err := r.js.AddStream(desired); err != nil {
+			return fmt.Errorf("failed to add stream: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get stream info: %w", err)
+	}
+
+	updated, drifts, err := r.Config.ReconcileStreamConfig(&info.Config)
+	if err != nil {
+		return err
+	}
+
+	var diffs []string
+	for _, drift := range drifts {
+		if drift.Immutable {
+			log.Printf("stream %s drifted from routing config, %s cannot be updated, recreate the stream to apply it", desired.Name, drift)
+			continue
+		}
+		diffs = append(diffs, drift.String())
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	// The stream keeps serving with its current settings if the update is rejected, so a config
+	// edit does not prevent the route from connecting.
+	log.Printf("stream %s drifted from routing config, updating: %s", desired.Name, strings.Join(diffs, ", "))
+	if _, err := r.js.UpdateStream(updated); err != nil {
+		log.Printf("failed to update stream %s (%s), keeping its current settings: %v", desired.Name, strings.Join(diffs, ", "), err)
+	}
+	return nil
+}
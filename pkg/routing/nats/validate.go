@@ -0,0 +1,169 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxBatchSize is the largest pull batch size accepted by Validate.
+const MaxBatchSize = 1000
+
+// validModes are the accepted values of the mode setting; empty selects push.
+var validModes = []string{"push", "pull", "request-reply"}
+
+// ValidationError describes an invalid setting of a single route in a routing config.
+type ValidationError struct {
+	Index    int    // position of the route in the config
+	Selector string // selector of the route, may be empty
+	Field    string // offending setting, using its YAML key
+	Message  string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("routes[%d] (selector %q): %s: %s", e.Index, e.Selector, e.Field, e.Message)
+}
+
+// ValidationErrors lists every problem found by Config.Validate.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d invalid route setting(s): %s", len(e), strings.Join(messages, "; "))
+}
+
+// Validate checks the routes of the config for missing settings, invalid values and conflicts
+// between routes. It returns nil or a ValidationErrors listing every problem found.
+func (c *Config) Validate() error {
+	var errs ValidationErrors
+	add := func(index int, route *NatConfig, field, format string, args ...any) {
+		errs = append(errs, &ValidationError{Index: index, Selector: route.Selector, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	selectors := make(map[string]int)
+	subjects := make(map[string]int)
+	for i := range c.MessageConfig.Routes {
+		route := &c.MessageConfig.Routes[i]
+
+		if route.Selector == "" {
+			add(i, route, "selector", "is required")
+		} else if err := validatePattern(route.Selector, selectorSeparator); err != nil {
+			add(i, route, "selector", "%v", err)
+		} else if first, found := selectors[selectorPattern(route.Selector)]; found {
+			if other := c.MessageConfig.Routes[first].Selector; other != route.Selector {
+				// overlapping wildcards resolve to the most specific selector, but "prefix/*" and
+				// "prefix/>" match exactly the same selectors
+				add(i, route, "selector", "wildcard is ambiguous with selector %s of routes[%d]", other, first)
+			} else {
+				add(i, route, "selector", "duplicates the selector of routes[%d]", first)
+			}
+		} else {
+			selectors[selectorPattern(route.Selector)] = i
+		}
+
+		if route.Subject == "" {
+			add(i, route, "subject", "is required")
+		} else if err := validatePattern(route.Subject, subjectSeparator); err != nil {
+			add(i, route, "subject", "%v", err)
+		} else if route.Mirror == nil {
+			// mirror routes consume the subject of their source stream
+			if first, found := subjects[route.Subject]; found {
+				add(i, route, "subject", "duplicates the subject of routes[%d]", first)
+			} else {
+				subjects[route.Subject] = i
+			}
+		}
+
+		if route.URL == "" {
+			add(i, route, "url", "is required")
+		}
+
+		if route.Mode != nil && *route.Mode != "" && !validMode(*route.Mode) {
+			add(i, route, "mode", "invalid mode %q, expected one of %s", *route.Mode, strings.Join(validModes, ", "))
+		}
+
+		if route.Mode != nil && *route.Mode == "request-reply" && route.Name != nil {
+			// the stream would acknowledge requests to the reply inbox before the responder replies
+			add(i, route, "name", "request-reply routes cannot be captured by stream %s", *route.Name)
+		}
+
+		if route.BatchSize != nil && (*route.BatchSize < 1 || *route.BatchSize > MaxBatchSize) {
+			add(i, route, "batch_size", "%d is out of range [1, %d]", *route.BatchSize, MaxBatchSize)
+		}
+
+		if route.MaxDeliver != nil && *route.MaxDeliver > 0 && len(route.Backoff) >= *route.MaxDeliver {
+			// JetStream rejects consumers whose backoff schedule is not shorter than max_deliver
+			add(i, route, "backoff", "%d backoff steps must be fewer than max_deliver %d", len(route.Backoff), *route.MaxDeliver)
+		}
+
+		if route.Mirror != nil {
+			switch {
+			case route.Name == nil || *route.Name == "":
+				add(i, route, "mirror", "requires the name of the mirror stream")
+			case *route.Mirror == *route.Name:
+				add(i, route, "mirror", "stream %s cannot mirror itself", *route.Name)
+			}
+		}
+
+		if route.Codec != nil {
+			if _, err := route.Encoding(); err != nil {
+				add(i, route, "codec", "%v", err)
+			}
+		}
+	}
+
+	for i := range c.MessageConfig.Routes {
+		route := &c.MessageConfig.Routes[i]
+		if route.Mirror == nil || route.Subject == "" {
+			continue
+		}
+		// a mirror can only deliver the subjects captured by its source stream
+		for j := range c.MessageConfig.Routes {
+			source := &c.MessageConfig.Routes[j]
+			if source.Mirror == nil && source.Name != nil && *source.Name == *route.Mirror &&
+				!SubjectMatches(source.Subject, route.Subject) {
+				add(i, route, "subject", "%s is not captured by mirrored stream %s (subject %s)", route.Subject, *route.Mirror, source.Subject)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validMode(mode string) bool {
+	for _, valid := range validModes {
+		if mode == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// SubjectMatches reports whether subject matches a NATS subject pattern,
+// where "*" matches exactly one token and ">" matches one or more trailing tokens.
+func SubjectMatches(pattern, subject string) bool {
+	if pattern == subject {
+		return true
+	}
+
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
@@ -0,0 +1,303 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quantumwake/alethic-ism-core-go/pkg/utils"
+)
+
+// defaultOrderingIdleTimeout is how long a key worker waits for messages before it is torn down.
+// ORDERING_IDLE_TIMEOUT replaces SUBJECT_CHANNEL_TTL_DURATION, which is still honoured when unset.
+var defaultOrderingIdleTimeout = utils.DurationFromEnvWithDefault("ORDERING_IDLE_TIMEOUT",
+	utils.DurationFromEnvWithDefault("SUBJECT_CHANNEL_TTL_DURATION", 10*time.Second))
+
+// ErrDispatcherClosed is returned when dispatching to a dispatcher that was shut down.
+var ErrDispatcherClosed = errors.New("ordered dispatcher is shut down")
+
+// OverflowPolicy decides what happens to a message dispatched to a key whose queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock waits for room in the queue, applying backpressure to the dispatching
+	// goroutine, and so to every key it dispatches.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowNak negatively acknowledges the message so it is redelivered later, out of order.
+	OverflowNak OverflowPolicy = "nak"
+	// OverflowDropOldest terminates the oldest buffered message of the key to make room, for keys
+	// where only the latest messages matter.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+)
+
+// OrderingOptions configures an OrderedDispatcher.
+type OrderingOptions struct {
+	QueueSize   int                             // messages buffered per key; defaults to 16
+	IdleTimeout time.Duration                   // idle time before a key worker is torn down; defaults to ORDERING_IDLE_TIMEOUT or 10s
+	Overflow    OverflowPolicy                  // policy applied when a key queue is full; defaults to OverflowBlock
+	Key         func(msg MessageEnvelop) string // ordering key of a message; defaults to its subject
+}
+
+func (o OrderingOptions) withDefaults() OrderingOptions {
+	if o.QueueSize <= 0 {
+		o.QueueSize = 16
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = defaultOrderingIdleTimeout
+	}
+	if o.Overflow == "" {
+		o.Overflow = OverflowBlock
+	}
+	if o.Key == nil {
+		o.Key = func(msg MessageEnvelop) string { return msg.Subject() }
+	}
+	return o
+}
+
+// HeaderKey returns a message key function reading the header name. Messages without it share the empty key.
+func HeaderKey(name string) func(msg MessageEnvelop) string {
+	return func(msg MessageEnvelop) string {
+		return msg.Headers().Get(name)
+	}
+}
+
+// FieldKey returns a message key function reading a top level field of the decoded message, such
+// as "route_id" of models.RouteMessage. Messages that fail to decode or lack the field share the empty key.
+// It is expensive: every message is decoded, and claim checked payloads downloaded, to compute its key,
+// so prefer HeaderKey with a header set by the publisher.
+func FieldKey(field string) func(msg MessageEnvelop) string {
+	return func(msg MessageEnvelop) string {
+		fields, err := msg.MessageMap()
+		if err != nil || fields[field] == nil {
+			return ""
+		}
+		if value, ok := fields[field].(string); ok {
+			return value
+		}
+		return fmt.Sprint(fields[field])
+	}
+}
+
+// KeyMetrics holds the processing metrics of one ordering key. They are reset when its worker is torn down.
+type KeyMetrics struct {
+	Queued     int       // messages buffered for the key
+	Processed  uint64    // messages handled
+	Blocked    uint64    // dispatches that waited for room in the queue
+	Overflowed uint64    // messages NAK'd or dropped because the queue was full
+	LastActive time.Time // when the last message of the key was handled
+}
+
+// OrderedDispatcher hands messages to handler one at a time per key, in dispatch order, while
+// different keys are processed concurrently. Each key gets a worker goroutine with a bounded
+// queue; a worker idle for the idle timeout is torn down, but never while messages are buffered
+// or being dispatched to it.
+type OrderedDispatcher struct {
+	handler func(ctx context.Context, msg MessageEnvelop)
+	options OrderingOptions
+
+	mu      sync.Mutex
+	workers map[string]*keyWorker
+	closed  bool
+	stop    chan struct{} // closed on shutdown, workers exit once their queue is empty
+	aborted atomic.Bool   // set when shutdown timed out, buffered messages are NAK'd instead of handled
+	wg      sync.WaitGroup
+}
+
+type orderedItem struct {
+	ctx context.Context
+	msg MessageEnvelop
+}
+
+type keyWorker struct {
+	key     string
+	queue   chan orderedItem
+	pending int // dispatches in progress, guarded by the dispatcher mutex
+	metrics KeyMetrics
+}
+
+// NewOrderedDispatcher returns a dispatcher processing messages with handler in per-key order.
+func NewOrderedDispatcher(handler func(ctx context.Context, msg MessageEnvelop), options OrderingOptions) *OrderedDispatcher {
+	return &OrderedDispatcher{
+		handler: handler,
+		options: options.withDefaults(),
+		workers: make(map[string]*keyWorker),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Dispatch queues msg on the worker of its key, starting one if needed. When the queue is full,
+// the overflow policy applies; with OverflowBlock, Dispatch waits until there is room or ctx is
+// done, in which case the message is NAK'd. Messages dispatched after Shutdown are NAK'd too.
+func (d *OrderedDispatcher) Dispatch(ctx context.Context, msg MessageEnvelop) error {
+	w, err := d.reserve(d.options.Key(msg))
+	if err != nil {
+		return errors.Join(err, msg.NakWithDelay(ctx, 0))
+	}
+	defer d.unreserve(w)
+
+	item := orderedItem{ctx: ctx, msg: msg}
+	select {
+	case w.queue <- item:
+		return nil
+	default:
+	}
+
+	switch d.options.Overflow {
+	case OverflowNak:
+		d.record(w, func(m *KeyMetrics) { m.Overflowed++ })
+		return msg.NakWithDelay(ctx, 0)
+	case OverflowDropOldest:
+		for {
+			select {
+			case w.queue <- item:
+				return nil
+			default:
+			}
+			select {
+			case oldest := <-w.queue:
+				d.record(w, func(m *KeyMetrics) { m.Overflowed++ })
+				if err := oldest.msg.Term(oldest.ctx); err != nil {
+					log.Printf("failed to drop oldest message of key %s: %v", w.key, err)
+				}
+			default:
+			}
+		}
+	default:
+		d.record(w, func(m *KeyMetrics) { m.Blocked++ })
+		select {
+		case w.queue <- item:
+			return nil
+		case <-ctx.Done():
+			return errors.Join(fmt.Errorf("queue of key %s is full: %w", w.key, ctx.Err()), msg.NakWithDelay(ctx, 0))
+		}
+	}
+}
+
+// reserve returns the worker of key, starting it if needed, and registers a dispatch in progress
+// so the worker is not torn down before the message is queued.
+func (d *OrderedDispatcher) reserve(key string) (*keyWorker, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, ErrDispatcherClosed
+	}
+
+	w, found := d.workers[key]
+	if !found {
+		w = &keyWorker{key: key, queue: make(chan orderedItem, d.options.QueueSize)}
+		d.workers[key] = w
+		d.wg.Add(1)
+		go d.run(w)
+	}
+	w.pending++
+	return w, nil
+}
+
+func (d *OrderedDispatcher) unreserve(w *keyWorker) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w.pending--
+}
+
+func (d *OrderedDispatcher) record(w *keyWorker, update func(m *KeyMetrics)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	update(&w.metrics)
+}
+
+// run handles the messages of a key until the worker is torn down, after being idle for the idle
+// timeout or on shutdown, once nothing is buffered or being dispatched to it.
+func (d *OrderedDispatcher) run(w *keyWorker) {
+	defer d.wg.Done()
+	idle := time.NewTimer(d.options.IdleTimeout)
+	defer idle.Stop()
+
+	stop := d.stop
+	for {
+		select {
+		case item := <-w.queue:
+			d.process(w, item)
+			idle.Reset(d.options.IdleTimeout)
+			if stop != nil {
+				continue // not shutting down, the worker stays until it is idle
+			}
+		case <-idle.C:
+			idle.Reset(d.options.IdleTimeout)
+		case <-stop:
+			// a closed channel is always ready: wait for the remaining dispatches on the queue instead
+			stop = nil
+		}
+
+		if d.retire(w) {
+			return
+		}
+	}
+}
+
+func (d *OrderedDispatcher) process(w *keyWorker, item orderedItem) {
+	if d.aborted.Load() {
+		if err := item.msg.NakWithDelay(item.ctx, 0); err != nil {
+			log.Printf("failed to nak buffered message of key %s: %v", w.key, err)
+		}
+		return
+	}
+
+	d.handler(item.ctx, item.msg)
+	d.record(w, func(m *KeyMetrics) {
+		m.Processed++
+		m.LastActive = time.Now()
+	})
+}
+
+// retire removes the worker if it has nothing left to handle.
+func (d *OrderedDispatcher) retire(w *keyWorker) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if w.pending > 0 || len(w.queue) > 0 {
+		return false
+	}
+	delete(d.workers, w.key)
+	return true
+}
+
+// Metrics returns the metrics of the keys that currently have a worker.
+func (d *OrderedDispatcher) Metrics() map[string]KeyMetrics {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	metrics := make(map[string]KeyMetrics, len(d.workers))
+	for key, w := range d.workers {
+		m := w.metrics
+		m.Queued = len(w.queue)
+		metrics[key] = m
+	}
+	return metrics
+}
+
+// Shutdown stops accepting messages and waits until ctx is done for the buffered messages to be
+// handled. If ctx expires first, messages still buffered are NAK'd so they are redelivered.
+func (d *OrderedDispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.stop)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		d.aborted.Store(true)
+		return fmt.Errorf("timed out waiting for ordered messages: %w", ctx.Err())
+	}
+}
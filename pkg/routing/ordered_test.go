@@ -0,0 +1,133 @@
+package routing_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/stretchr/testify/require"
+)
+
+// orderedMsg is a message envelope recording how it was acknowledged.
+type orderedMsg struct {
+	routing.MessageEnvelop
+	subject string
+	seq     int
+	naked   atomic.Bool
+	termed  atomic.Bool
+}
+
+func (m *orderedMsg) Subject() string { return m.subject }
+
+func (m *orderedMsg) NakWithDelay(context.Context, time.Duration) error {
+	m.naked.Store(true)
+	return nil
+}
+
+func (m *orderedMsg) Term(context.Context) error {
+	m.termed.Store(true)
+	return nil
+}
+
+func TestOrderedDispatcher_OrdersPerKey(t *testing.T) {
+	ctx := t.Context()
+
+	var mu sync.Mutex
+	handled := map[string][]int{}
+	dispatcher := routing.NewOrderedDispatcher(func(ctx context.Context, msg routing.MessageEnvelop) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		handled[msg.Subject()] = append(handled[msg.Subject()], msg.(*orderedMsg).seq)
+	}, routing.OrderingOptions{QueueSize: 4, IdleTimeout: 5 * time.Millisecond})
+
+	for seq := range 60 {
+		subject := fmt.Sprintf("test.ordered.%d", seq%3)
+		require.NoError(t, dispatcher.Dispatch(ctx, &orderedMsg{subject: subject, seq: seq}))
+		if seq == 30 {
+			time.Sleep(50 * time.Millisecond) // let the idle workers be torn down and restarted
+		}
+	}
+	require.NoError(t, dispatcher.Shutdown(ctx))
+
+	require.Len(t, handled, 3)
+	for key, seqs := range handled {
+		require.Len(t, seqs, 20, key)
+		for i := 1; i < len(seqs); i++ {
+			require.Less(t, seqs[i-1], seqs[i], "messages of %s handled out of order", key)
+		}
+	}
+	require.Empty(t, dispatcher.Metrics())
+
+	late := &orderedMsg{subject: "test.ordered.0"}
+	require.ErrorIs(t, dispatcher.Dispatch(ctx, late), routing.ErrDispatcherClosed)
+	require.True(t, late.naked.Load())
+}
+
+func TestOrderedDispatcher_OverflowPolicies(t *testing.T) {
+	ctx := t.Context()
+
+	tests := []struct {
+		policy   routing.OverflowPolicy
+		overflow func(queued, rejected *orderedMsg)
+	}{
+		{routing.OverflowNak, func(queued, rejected *orderedMsg) {
+			require.True(t, rejected.naked.Load())
+			require.False(t, queued.termed.Load())
+		}},
+		{routing.OverflowDropOldest, func(queued, rejected *orderedMsg) {
+			require.True(t, queued.termed.Load())
+			require.False(t, rejected.naked.Load())
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			started, release := make(chan struct{}, 3), make(chan struct{})
+			dispatcher := routing.NewOrderedDispatcher(func(ctx context.Context, msg routing.MessageEnvelop) {
+				started <- struct{}{}
+				<-release
+			}, routing.OrderingOptions{QueueSize: 1, Overflow: tt.policy})
+
+			require.NoError(t, dispatcher.Dispatch(ctx, &orderedMsg{subject: "test.overflow"}))
+			<-started // the worker is busy with the first message
+
+			queued, rejected := &orderedMsg{subject: "test.overflow"}, &orderedMsg{subject: "test.overflow"}
+			require.NoError(t, dispatcher.Dispatch(ctx, queued))
+			require.NoError(t, dispatcher.Dispatch(ctx, rejected))
+			tt.overflow(queued, rejected)
+			require.Equal(t, uint64(1), dispatcher.Metrics()["test.overflow"].Overflowed)
+
+			close(release)
+			require.NoError(t, dispatcher.Shutdown(ctx))
+		})
+	}
+}
+
+func TestOrderedDispatcher_ShutdownTimeoutNaksBuffered(t *testing.T) {
+	ctx := t.Context()
+
+	release := make(chan struct{})
+	dispatcher := routing.NewOrderedDispatcher(func(ctx context.Context, msg routing.MessageEnvelop) {
+		<-release
+	}, routing.OrderingOptions{QueueSize: 4})
+
+	msgs := []*orderedMsg{{subject: "test.shutdown"}, {subject: "test.shutdown"}, {subject: "test.shutdown"}}
+	for _, msg := range msgs {
+		require.NoError(t, dispatcher.Dispatch(ctx, msg))
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, dispatcher.Shutdown(timeout), context.DeadlineExceeded)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return msgs[1].naked.Load() && msgs[2].naked.Load()
+	}, time.Second, 5*time.Millisecond)
+	require.False(t, msgs[0].naked.Load(), "the in-flight message is left to its handler")
+}
@@ -0,0 +1,108 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// HeaderReplyError is set on error replies to the code of the ReplyError carried in the body.
+const HeaderReplyError = "Reply-Error"
+
+// Codes of the error replies sent by responders.
+const (
+	ReplyErrorInternal = "internal"
+	ReplyErrorTimeout  = "timeout"
+)
+
+// Responder handles a request received by a route in "request-reply" mode and returns the reply,
+// which is encoded with the route codec. A returned error is sent back as a ReplyError; wrap a
+// *ReplyError to control its code.
+type Responder func(ctx context.Context, msg MessageEnvelop) (any, error)
+
+// ReplyError is the structured error replied to a request the responder failed to handle. It is
+// returned, wrapped, by Request when a reply carries the Reply-Error header.
+type ReplyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewReplyError returns a ReplyError with an application specific code.
+func NewReplyError(code, message string) *ReplyError {
+	return &ReplyError{Code: code, Message: message}
+}
+
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// HandleRequest invokes responder for a request and returns the encoded reply. The responder is
+// given until timeout, if positive, to reply; failures and timeouts produce an error reply.
+func HandleRequest(ctx context.Context, responder Responder, msg MessageEnvelop, encoding *Encoding, timeout time.Duration) ([]byte, Header) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		reply any
+		err   error
+	}
+	done := make(chan result, 1) // buffered, a responder finishing after the timeout must not block
+	go func() {
+		reply, err := responder(ctx, msg)
+		done <- result{reply: reply, err: err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = fmt.Errorf("request on %s was not handled: %w", msg.Subject(), ctx.Err())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			res.err = NewReplyError(ReplyErrorTimeout, fmt.Sprintf("request on %s was not handled in time", msg.Subject()))
+		}
+	}
+
+	header := Header{}
+	if res.err == nil {
+		data, err := encoding.Encode(res.reply, header)
+		if err == nil {
+			return data, header
+		}
+		res.err = fmt.Errorf("failed to encode reply: %w", err)
+	}
+	return errorReply(res.err)
+}
+
+// errorReply builds the JSON encoded reply of err.
+func errorReply(err error) ([]byte, Header) {
+	var replyErr *ReplyError
+	if !errors.As(err, &replyErr) {
+		replyErr = NewReplyError(ReplyErrorInternal, err.Error())
+	}
+
+	header := Header{}
+	header.Set(HeaderReplyError, replyErr.Code)
+	header.Set(HeaderContentType, ContentTypeJSON)
+	data, _ := json.Marshal(replyErr)
+	return data, header
+}
+
+// ReplyErr returns the *ReplyError carried by a reply, or nil if the reply is not an error reply.
+func ReplyErr(header Header, data []byte) error {
+	code := header.Get(HeaderReplyError)
+	if code == "" {
+		return nil
+	}
+
+	replyErr := &ReplyError{}
+	if err := json.Unmarshal(data, replyErr); err != nil {
+		replyErr.Message = string(data)
+	}
+	replyErr.Code = code
+	return replyErr
+}
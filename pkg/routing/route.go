@@ -2,10 +2,14 @@ package routing
 
 import (
 	"context"
+	"errors"
 	"github.com/nats-io/nats.go"
 	"time"
 )
 
+// ErrNoDeadLetter is returned when dead-lettering a message whose route has no dead-letter subject.
+var ErrNoDeadLetter = errors.New("no dead letter subject configured")
+
 // MessageEnvelop provides an abstraction for message handling across different routing implementations.
 // It encapsulates the raw message data and provides methods to acknowledge, retrieve, and convert messages.
 type MessageEnvelop interface {
@@ -17,20 +21,35 @@ type MessageEnvelop interface {
 	// allowing it to be redelivered later after a specified delay.
 	NakWithDelay(ctx context.Context, delay time.Duration) error
 
-	// MessageRaw returns the raw message data as a byte slice.
-	// Returns an error if the message is empty or cannot be retrieved.
+	// Term terminally acknowledges the message, instructing the broker to never redeliver it.
+	// Used for messages that can never be processed successfully (e.g. malformed payloads).
+	Term(ctx context.Context) error
+
+	// Metadata returns the JetStream delivery metadata (sequence, delivery count, stream, consumer).
+	// Returns an error for messages that were not delivered by a JetStream consumer.
+	Metadata() (*nats.MsgMetadata, error)
+
+	// MessageRaw returns the raw message data as a byte slice, decompressed according to
+	// the Content-Encoding header. Returns an error if the message is empty or cannot be retrieved.
 	MessageRaw() ([]byte, error)
 
+	// Decode unmarshals the message data into v, selecting the codec from the Content-Type
+	// header (JSON when absent).
+	Decode(v any) error
+
 	// MessageString returns the message data as a string.
 	// This is a convenience method that converts the raw bytes to a string.
 	MessageString() (string, error)
 
-	// MessageMap unmarshals the message data into a map[string]any.
-	// Useful for handling JSON messages. Returns an error if unmarshaling fails.
+	// MessageMap unmarshals the message data into a map[string]any using Decode.
+	// Returns an error if unmarshaling fails.
 	MessageMap() (map[string]any, error)
 
 	// Subject returns the subject/topic associated with the message.
 	Subject() string
+
+	// Headers returns the headers published with the message, or nil if there are none.
+	Headers() Header
 }
 
 // Route defines the interface for message routing implementations.
@@ -45,12 +64,15 @@ type Route interface {
 	// Request sends a request message and waits for a reply.
 	// This implements the request-reply pattern where the caller blocks until a response is received.
 	// The msg parameter can be []byte, string, map[string]any, or any JSON-marshalable type.
-	Request(ctx context.Context, msg interface{}) (*nats.Msg, error)
+	// Options such as WithHeader attach metadata to the request. Error replies of responders
+	// (see Responder) are returned as an error wrapping a *ReplyError.
+	Request(ctx context.Context, msg interface{}, opts ...PublishOption) (*nats.Msg, error)
 
 	// Publish sends a message to the configured subject/topic without waiting for a response.
 	// Supports both standard NATS and JetStream publishing based on configuration.
 	// The msg parameter can be []byte, string, map[string]any, or any JSON-marshalable type.
-	Publish(ctx context.Context, msg any) error
+	// Options such as WithHeader attach metadata to the message.
+	Publish(ctx context.Context, msg any, opts ...PublishOption) error
 
 	// Subscribe starts listening for messages on the configured subject/topic.
 	// Messages are delivered to the callback function set in the route configuration.
@@ -0,0 +1,118 @@
+package routing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nats-io/nats.go"
+)
+
+// HeaderResponderID identifies the responder instance that sent a reply.
+const HeaderResponderID = "Responder-Id"
+
+// ScatterGatherer is implemented by routes that can send one request to every responder on the
+// subject and collect their replies.
+type ScatterGatherer interface {
+	// ScatterGather publishes msg as a request with a unique reply inbox and streams the replies
+	// through the returned channel. The channel is closed once the gather target is reached, there
+	// are no responders, or ctx is done; without a context deadline the route request timeout applies.
+	ScatterGather(ctx context.Context, msg any, gather GatherOptions, opts ...PublishOption) (<-chan *Reply, error)
+}
+
+// GatherOptions sets when a scatter-gather request stops collecting replies, besides its deadline.
+type GatherOptions struct {
+	MaxReplies int // stop after this many replies, successful or not; 0 for no limit
+	Quorum     int // stop after this many successful replies; 0 for no quorum
+}
+
+// target reports whether replies, of which succeeded were successful, complete the gather.
+func (o GatherOptions) target(replies, succeeded int) bool {
+	return (o.MaxReplies > 0 && replies >= o.MaxReplies) || (o.Quorum > 0 && succeeded >= o.Quorum)
+}
+
+// Reply is a reply received by a scatter-gather request.
+type Reply struct {
+	Msg       *nats.Msg
+	Responder string // Responder-Id header of the reply, empty if not set
+	Err       error  // *ReplyError for error replies
+}
+
+// GatherReplies forwards the replies received on msgs until the gather target is reached, a
+// no responders status is received, or ctx is done. It then calls stop and closes the returned
+// channel. Route implementations use it to serve ScatterGather.
+func GatherReplies(ctx context.Context, gather GatherOptions, msgs <-chan *nats.Msg, stop func()) <-chan *Reply {
+	replies := make(chan *Reply)
+	go func() {
+		defer close(replies)
+		defer stop()
+
+		var received, succeeded int
+		for {
+			var msg *nats.Msg
+			select {
+			case msg = <-msgs:
+			case <-ctx.Done():
+				return
+			}
+
+			reply := &Reply{Msg: msg}
+			if msg.Header.Get("Status") == "503" && len(msg.Data) == 0 {
+				reply.Err = nats.ErrNoResponders
+			} else {
+				reply.Responder = msg.Header.Get(HeaderResponderID)
+				reply.Err = ReplyErr(Header(msg.Header), msg.Data)
+				received++
+				if reply.Err == nil {
+					succeeded++
+				}
+			}
+
+			select {
+			case replies <- reply:
+			case <-ctx.Done():
+				return
+			}
+			if errors.Is(reply.Err, nats.ErrNoResponders) || gather.target(received, succeeded) {
+				return
+			}
+		}
+	}()
+	return replies
+}
+
+// GatherResult holds the replies collected by Gather.
+type GatherResult struct {
+	Replies []*Reply // successful replies, in arrival order
+	Failed  []*Reply // error replies, with the responder and its error
+	Err     error    // why the gather target was not reached; nil if it was, or if none was set
+}
+
+// Gather sends msg as a scatter-gather request on route and collects the replies. When ctx
+// expires before the gather target is reached, the partial result is returned with Err set.
+func Gather(ctx context.Context, route ScatterGatherer, msg any, gather GatherOptions, opts ...PublishOption) (*GatherResult, error) {
+	replies, err := route.ScatterGather(ctx, msg, gather, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GatherResult{}
+	for reply := range replies {
+		switch {
+		case errors.Is(reply.Err, nats.ErrNoResponders):
+			result.Err = reply.Err
+		case reply.Err != nil:
+			result.Failed = append(result.Failed, reply)
+		default:
+			result.Replies = append(result.Replies, reply)
+		}
+	}
+
+	targeted := gather.MaxReplies > 0 || gather.Quorum > 0
+	if result.Err == nil && targeted && !gather.target(len(result.Replies)+len(result.Failed), len(result.Replies)) {
+		result.Err = ctx.Err()
+		if result.Err == nil {
+			result.Err = context.DeadlineExceeded // the route request timeout expired
+		}
+	}
+	return result, nil
+}
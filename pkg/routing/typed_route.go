@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrDecode is wrapped by errors produced when a payload cannot be decoded into the expected type.
+// Decode errors are permanent: the same payload will never decode on redelivery.
+var ErrDecode = errors.New("failed to decode message")
+
+// TypedRoute publishes and decodes payloads of type T on top of a Route using a Codec.
+//
+//	monitor := routing.NewTypedRoute[models.MonitorMessage](route, nil)
+//	err := monitor.Publish(ctx, models.MonitorMessage{RouteID: routeID, Status: processor.Completed})
+//
+// To consume typed payloads, wrap the callback with handler.Wrap, passing the route codec with
+// handler.WithCodec so messages without a Content-Type header decode with it.
+type TypedRoute[T any] struct {
+	route Route
+	codec Codec
+}
+
+// NewTypedRoute wraps route with typed publishing; a nil codec defaults to JSON.
+func NewTypedRoute[T any](route Route, codec Codec) *TypedRoute[T] {
+	if codec == nil {
+		codec = JSON
+	}
+	return &TypedRoute[T]{route: route, codec: codec}
+}
+
+// Route returns the underlying route.
+func (r *TypedRoute[T]) Route() Route {
+	return r.route
+}
+
+// Codec returns the codec used to encode and decode payloads.
+func (r *TypedRoute[T]) Codec() Codec {
+	return r.codec
+}
+
+// Publish encodes msg with the route codec and publishes it with a Content-Type header.
+func (r *TypedRoute[T]) Publish(ctx context.Context, msg T, opts ...PublishOption) error {
+	data, err := r.codec.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	return r.route.Publish(ctx, data, r.withContentType(opts)...)
+}
+
+// Request encodes msg with the route codec and waits for a reply.
+func (r *TypedRoute[T]) Request(ctx context.Context, msg T, opts ...PublishOption) (*nats.Msg, error) {
+	data, err := r.codec.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return r.route.Request(ctx, data, r.withContentType(opts)...)
+}
+
+// PublishAsync encodes msg with the route codec and publishes it without waiting for the
+// acknowledgement. It returns ErrAsyncNotSupported if the route is not an AsyncPublisher.
+func (r *TypedRoute[T]) PublishAsync(ctx context.Context, msg T, opts ...PublishOption) (*PublishFuture, error) {
+	publisher, ok := r.route.(AsyncPublisher)
+	if !ok {
+		return nil, ErrAsyncNotSupported
+	}
+	data, err := r.codec.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return publisher.PublishAsync(ctx, data, r.withContentType(opts)...)
+}
+
+// withContentType returns a copy of opts stamping the codec content type header.
+func (r *TypedRoute[T]) withContentType(opts []PublishOption) []PublishOption {
+	return append(append([]PublishOption(nil), opts...), WithHeader(HeaderContentType, r.codec.ContentType()))
+}
+
+// Decode decodes msg into T, returning an error wrapping ErrDecode on failure.
+func (r *TypedRoute[T]) Decode(msg MessageEnvelop) (T, error) {
+	return Decode[T](r.codec, msg)
+}
+
+// Decode decodes the payload of msg into T, returning an error wrapping ErrDecode on failure. The
+// codec named by the Content-Type header takes precedence, codec is used for messages without one
+// (JSON if nil).
+func Decode[T any](codec Codec, msg MessageEnvelop) (T, error) {
+	var payload T
+	if codec == nil {
+		codec = JSON
+	}
+	raw, err := msg.MessageRaw()
+	if err != nil {
+		return payload, fmt.Errorf("%w on subject %s: %w", ErrDecode, msg.Subject(), err)
+	}
+	if err = CodecForHeader(msg.Headers(), codec).Unmarshal(raw, &payload); err != nil {
+		return payload, fmt.Errorf("%w on subject %s: %w", ErrDecode, msg.Subject(), err)
+	}
+	return payload, nil
+}
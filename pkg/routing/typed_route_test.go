@@ -0,0 +1,87 @@
+package routing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/quantumwake/alethic-ism-core-go/pkg/data/models"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/repository/processor"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/handler"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/memory"
+	"github.com/quantumwake/alethic-ism-core-go/pkg/routing/nats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedRoute_PublishAndDecode(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{Selector: "test/typed", Subject: "test.typed", URL: nats.MemoryURLScheme + t.Name()}
+
+	received := make(chan models.MonitorMessage, 1)
+	contentTypes := make(chan string, 1)
+	callback := handler.Wrap(func(ctx context.Context, msg routing.MessageEnvelop, payload models.MonitorMessage) error {
+		contentTypes <- msg.Headers().Get(routing.HeaderContentType)
+		received <- payload
+		return nil
+	})
+
+	route := memory.NewRoute(config, callback)
+	require.NoError(t, route.Subscribe(ctx))
+
+	typed := routing.NewTypedRoute[models.MonitorMessage](route, nil)
+	require.NoError(t, typed.Publish(ctx, models.MonitorMessage{
+		Type:    models.MonitorProcessorState,
+		RouteID: "route-1",
+		Status:  processor.Completed,
+	}))
+
+	select {
+	case msg := <-received:
+		require.Equal(t, "route-1", msg.RouteID)
+		require.Equal(t, processor.Completed, msg.Status)
+		require.Equal(t, routing.ContentTypeJSON, <-contentTypes)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+}
+
+func TestTypedRoute_DecodeWithCodec(t *testing.T) {
+	ctx := t.Context()
+	config := &nats.NatConfig{Selector: "test/typed", Subject: "test.typed", URL: nats.MemoryURLScheme + t.Name()}
+
+	typed := routing.NewTypedRoute[models.RouteMessage](nil, routing.MsgPack)
+	decoded := make(chan models.RouteMessage, 1)
+	errs := make(chan error, 1)
+	route := memory.NewRoute(config, func(ctx context.Context, msg routing.MessageEnvelop) {
+		payload, err := typed.Decode(msg)
+		if err != nil {
+			errs <- err
+			return
+		}
+		decoded <- payload
+	})
+	require.NoError(t, route.Subscribe(ctx))
+
+	// Without a Content-Type header, payloads decode with the route codec.
+	data, err := routing.MsgPack.Marshal(models.RouteMessage{RouteID: "route-1"})
+	require.NoError(t, err)
+	require.NoError(t, route.Publish(ctx, data))
+	select {
+	case msg := <-decoded:
+		require.Equal(t, "route-1", msg.RouteID)
+	case err := <-errs:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+
+	require.NoError(t, route.Publish(ctx, "not msgpack", routing.WithHeader(routing.HeaderContentType, routing.ContentTypeJSON)))
+	select {
+	case err := <-errs:
+		require.ErrorIs(t, err, routing.ErrDecode)
+		require.ErrorIs(t, err, handler.ErrDecode, "the handler package reports the same decode errors")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for error")
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"os"
+	"regexp"
 	"strconv"
 	"time"
 )
@@ -33,3 +34,18 @@ func DurationFromEnvWithDefault(key string, defaultValue time.Duration) time.Dur
 
 	return defaultValue
 }
+
+// envReference matches ${VAR} and ${VAR:-default} references.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// ExpandEnv replaces ${VAR} references in s with the value of the environment variable VAR,
+// and ${VAR:-default} references with default when VAR is unset or empty. Other uses of $ are left as is.
+func ExpandEnv(s string) string {
+	return envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		match := envReference.FindStringSubmatch(ref)
+		if value := StringFromEnvWithDefault(match[1], ""); value != "" {
+			return value
+		}
+		return match[2]
+	})
+}